@@ -1,24 +1,50 @@
 package cgroups
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	KILL_TIMEOUT       = 5 * time.Second
+	KILL_POLL_INTERVAL = 10 * time.Millisecond
+)
+
 type CgroupManager struct {
-	Path string // The path of this cgroup in the overall hierarchy.
+	Path       string      // The path of this cgroup in the overall hierarchy.
+	fs         CgroupFS    // The hierarchies this cgroup is in.
+	subsystems []Subsystem // The subsystems of the cgroup version of fs.
 }
 
+// Manage the cgroup in the hierarchies mounted on the host.
 func NewCgroupManager(path string) *CgroupManager {
+	return NewCgroupManagerWithFS(path, hostFS)
+}
+
+// Manage the cgroup in the hierarchies of fs.
+func NewCgroupManagerWithFS(path string, fs CgroupFS) *CgroupManager {
 	return &CgroupManager{
-		Path: path,
+		Path:       path,
+		fs:         fs,
+		subsystems: newSubsystems(fs),
 	}
 }
 
 // Add process of pid to this cgroup.
+// The process escapes the limitations if any subsystem fails,
+// so the first error is returned.
 func (c *CgroupManager) Apply(pid int) error {
-	for _, subsystem := range subsystems {
+	for _, subsystem := range c.subsystems {
 		if err := subsystem.Apply(c.Path, pid); err != nil {
-			log.Errorf("Apply() cgroup %s to pid %d error %v", c.Path, pid, err)
+			return fmt.Errorf("Apply() cgroup %s of subsystem %s to pid %d error %v", c.Path, subsystem.Name(), pid, err)
 		}
 	}
 
@@ -26,10 +52,11 @@ func (c *CgroupManager) Apply(pid int) error {
 }
 
 // Set resource limitations of this cgroup.
+// The first error is returned.
 func (c *CgroupManager) Set(res *ResourceConfig) error {
-	for _, subsystem := range subsystems {
+	for _, subsystem := range c.subsystems {
 		if err := subsystem.Set(c.Path, res); err != nil {
-			log.Errorf("Set() cgroup %s error %v", c.Path, err)
+			return fmt.Errorf("Set() cgroup %s of subsystem %s error %v", c.Path, subsystem.Name(), err)
 		}
 	}
 
@@ -37,12 +64,236 @@ func (c *CgroupManager) Set(res *ResourceConfig) error {
 }
 
 // Release this cgroup.
+// A cgroup with processes cannot be removed, so they are killed first.
+// Continue with other subsystems on failure and return the last error.
 func (c *CgroupManager) Destroy() error {
-	for _, subsystem := range subsystems {
+	if err := c.killAll(); err != nil {
+		log.Warnf("killAll() of cgroup %s error %v", c.Path, err)
+	}
+
+	var retErr error
+	for _, subsystem := range c.subsystems {
 		if err := subsystem.Remove(c.Path); err != nil {
-			log.Errorf("Remove() cgroup %s error %v", c.Path, err)
+			retErr = fmt.Errorf("Remove() cgroup %s of subsystem %s error %v", c.Path, subsystem.Name(), err)
+			log.Error(retErr.Error())
+		}
+	}
+
+	return retErr
+}
+
+// Return the pids of all the processes in this cgroup.
+// The process set of every hierarchy is merged on v1 in case some process
+// has not joined all of them.
+func (c *CgroupManager) GetPids() ([]int, error) {
+	pidSet := map[int]bool{}
+	var pids []int
+	for _, subsystem := range c.subsystems {
+		cgroupRoot := c.fs.Root(subsystem.Name())
+		if len(cgroupRoot) == 0 {
+			continue
+		}
+		procsFilePath := filepath.Join(cgroupRoot, c.Path, "cgroup.procs")
+		contentBytes, err := ioutil.ReadFile(procsFilePath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("ReadFile() %s error %v", procsFilePath, err)
+		}
+		for _, pidStr := range strings.Fields(string(contentBytes)) {
+			pid, err := strconv.Atoi(pidStr)
+			if err != nil {
+				return nil, fmt.Errorf("Atoi() %s error %v", pidStr, err)
+			}
+			if !pidSet[pid] {
+				pidSet[pid] = true
+				pids = append(pids, pid)
+			}
+		}
+		// All the subsystems share the same cgroup on v2.
+		if c.fs.Version() == CGROUP_V2 {
+			break
+		}
+	}
+
+	return pids, nil
+}
+
+// Send sig to every process in this cgroup.
+// The cgroup is frozen meanwhile so that no process can fork a new one to
+// escape, and it is thawed afterwards for the signals to be handled.
+// SIGKILL is sent with cgroup.kill if the kernel supports it.
+func (c *CgroupManager) Kill(sig syscall.Signal) error {
+	if sig == syscall.SIGKILL && c.fs.Version() == CGROUP_V2 {
+		killFilePath := filepath.Join(c.fs.Root(""), c.Path, "cgroup.kill")
+		if _, err := os.Stat(killFilePath); err == nil {
+			frozen, err := c.Frozen()
+			if err != nil {
+				log.Warnf("Frozen() cgroup %s error %v", c.Path, err)
+			}
+			if err := ioutil.WriteFile(killFilePath, []byte("1"), 0644); err != nil {
+				return fmt.Errorf("WriteFile() %s error %v", killFilePath, err)
+			}
+			// Like the other signals, leave the cgroup thawed, or the
+			// processes started in it later hang.
+			if frozen {
+				if err := c.Thaw(); err != nil {
+					return fmt.Errorf("Thaw() cgroup %s error %v", c.Path, err)
+				}
+			}
+			return nil
 		}
 	}
 
+	frozen := true
+	if err := c.Freeze(); err != nil {
+		log.Warnf("Freeze() cgroup %s error %v, kill without freezing", c.Path, err)
+		frozen = false
+	}
+
+	pids, err := c.GetPids()
+	if err != nil {
+		if frozen {
+			c.Thaw()
+		}
+		return fmt.Errorf("GetPids() cgroup %s error %v", c.Path, err)
+	}
+	var retErr error
+	for _, pid := range pids {
+		if err := syscall.Kill(pid, sig); err != nil && err != syscall.ESRCH {
+			retErr = fmt.Errorf("Kill() pid %d with signal %v error %v", pid, sig, err)
+		}
+	}
+
+	if frozen {
+		if err := c.Thaw(); err != nil {
+			return fmt.Errorf("Thaw() cgroup %s error %v", c.Path, err)
+		}
+	}
+
+	return retErr
+}
+
+// Kill all the processes in this cgroup and wait until they exit.
+func (c *CgroupManager) killAll() error {
+	deadline := time.Now().Add(KILL_TIMEOUT)
+	for {
+		pids, err := c.GetPids()
+		if err != nil {
+			return fmt.Errorf("GetPids() cgroup %s error %v", c.Path, err)
+		}
+		if len(pids) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Processes %v in cgroup %s do not exit within %v", pids, c.Path, KILL_TIMEOUT)
+		}
+		if err := c.Kill(syscall.SIGKILL); err != nil {
+			return fmt.Errorf("Kill() cgroup %s error %v", c.Path, err)
+		}
+		time.Sleep(KILL_POLL_INTERVAL)
+	}
+}
+
+// Implemented by the memory subsystems of both cgroup versions.
+type oomWatcher interface {
+	OOMKillCount(path string) (int, error)
+	NotifyOOM(path string, done <-chan struct{}) (<-chan struct{}, error)
+}
+
+func (c *CgroupManager) getOOMWatcher() (oomWatcher, error) {
+	for _, subsystem := range c.subsystems {
+		if w, ok := subsystem.(oomWatcher); ok && len(c.fs.Root(subsystem.Name())) != 0 {
+			return w, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Cannot find the memory subsystem")
+}
+
+// Return the number of processes in this cgroup killed by the OOM killer.
+func (c *CgroupManager) OOMKillCount() (int, error) {
+	w, err := c.getOOMWatcher()
+	if err != nil {
+		return 0, err
+	}
+	count, err := w.OOMKillCount(c.Path)
+	if err != nil {
+		return 0, fmt.Errorf("OOMKillCount() of cgroup %s error %v", c.Path, err)
+	}
+
+	return count, nil
+}
+
+// Return a channel receiving a value on every OOM event of this cgroup.
+// The channel is closed after done is closed or the cgroup is removed.
+func (c *CgroupManager) NotifyOOM(done <-chan struct{}) (<-chan struct{}, error) {
+	w, err := c.getOOMWatcher()
+	if err != nil {
+		return nil, err
+	}
+	ch, err := w.NotifyOOM(c.Path, done)
+	if err != nil {
+		return nil, fmt.Errorf("NotifyOOM() of cgroup %s error %v", c.Path, err)
+	}
+
+	return ch, nil
+}
+
+// Implemented by the freezer subsystems of both cgroup versions.
+type freezer interface {
+	Freeze(path string, frozen bool) error
+	FreezerState(path string) (string, error)
+}
+
+func (c *CgroupManager) getFreezer() (freezer, error) {
+	for _, subsystem := range c.subsystems {
+		if f, ok := subsystem.(freezer); ok && len(c.fs.Root(subsystem.Name())) != 0 {
+			return f, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Cannot find the freezer subsystem")
+}
+
+// Freeze all the processes in this cgroup.
+// Return after the kernel confirms the cgroup is frozen.
+func (c *CgroupManager) Freeze() error {
+	f, err := c.getFreezer()
+	if err != nil {
+		return err
+	}
+	if err := f.Freeze(c.Path, true); err != nil {
+		return fmt.Errorf("Freeze() cgroup %s error %v", c.Path, err)
+	}
+
 	return nil
 }
+
+// Resume all the processes in this cgroup.
+func (c *CgroupManager) Thaw() error {
+	f, err := c.getFreezer()
+	if err != nil {
+		return err
+	}
+	if err := f.Freeze(c.Path, false); err != nil {
+		return fmt.Errorf("Freeze() cgroup %s error %v", c.Path, err)
+	}
+
+	return nil
+}
+
+// Return whether this cgroup is frozen.
+func (c *CgroupManager) Frozen() (bool, error) {
+	f, err := c.getFreezer()
+	if err != nil {
+		return false, err
+	}
+	state, err := f.FreezerState(c.Path)
+	if err != nil {
+		return false, fmt.Errorf("FreezerState() cgroup %s error %v", c.Path, err)
+	}
+
+	return state == FREEZER_STATE_FROZEN, nil
+}
@@ -0,0 +1,385 @@
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+var fakeSubsystemsV1 = []string{"cpu", "cpuacct", "cpuset", "memory", "pids", "blkio", "freezer"}
+
+// Create a tree like /sys/fs/cgroup in a temporary directory.
+// The hugetlb subsystem is mounted on v1 only if hugetlb is set.
+func newFakeCgroupFS(t *testing.T, version int, hugetlb bool) (CgroupFS, string) {
+	dir, err := ioutil.TempDir("", "cgroups")
+	if err != nil {
+		t.Fatalf("TempDir() error %v", err)
+	}
+
+	files := map[string]string{}
+	if version == CGROUP_V2 {
+		files["cgroup.controllers"] = "cpuset cpu io memory hugetlb pids"
+	} else {
+		for _, subsystem := range fakeSubsystemsV1 {
+			files[filepath.Join(subsystem, "cgroup.procs")] = ""
+		}
+		if hugetlb {
+			files["hugetlb/cgroup.procs"] = ""
+		}
+		files["cpuset/cpuset.cpus"] = "0-3"
+		files["cpuset/cpuset.mems"] = "0"
+	}
+	for name, content := range files {
+		filePath := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatalf("MkdirAll() error %v", err)
+		}
+		if err := ioutil.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile() error %v", err)
+		}
+	}
+
+	return NewDirCgroupFS(dir, version), dir
+}
+
+func readFakeFile(t *testing.T, filePath string) string {
+	contentBytes, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("ReadFile() error %v", err)
+	}
+	return strings.TrimSpace(string(contentBytes))
+}
+
+// Make filePath a fifo recording every write, since the kernel enables the
+// written controller in cgroup.subtree_control instead of replacing the
+// content like a regular file.
+// The returned function stops recording after the last write and returns
+// the written controllers in order.
+func recordFakeSubtreeControl(t *testing.T, filePath string) func() []string {
+	if err := syscall.Mkfifo(filePath, 0644); err != nil {
+		t.Fatalf("Mkfifo() error %v", err)
+	}
+	done := make(chan string)
+	go func() {
+		// Every write opens the fifo again, so keep reading until the
+		// newline written on stop.
+		var content string
+		for !strings.HasSuffix(content, "\n") {
+			contentBytes, err := ioutil.ReadFile(filePath)
+			if err != nil {
+				break
+			}
+			content += string(contentBytes)
+		}
+		done <- content
+	}()
+
+	return func() []string {
+		if err := ioutil.WriteFile(filePath, []byte("\n"), 0644); err != nil {
+			t.Fatalf("WriteFile() error %v", err)
+		}
+		return strings.Fields(strings.ReplaceAll(<-done, "+", " +"))
+	}
+}
+
+// The processes exit before the cgroup is destroyed.
+func clearFakeProcs(t *testing.T, dir string) {
+	filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if err == nil && info.Name() == "cgroup.procs" {
+			if err := ioutil.WriteFile(filePath, nil, 0644); err != nil {
+				t.Fatalf("WriteFile() error %v", err)
+			}
+		}
+		return nil
+	})
+}
+
+var fakeResourceConfig = &ResourceConfig{
+	MemoryLimit:          "67108864",
+	MemorySwap:           "134217728",
+	MemoryReservation:    "33554432",
+	CpuShares:            "1024",
+	CpuPeriod:            "100000",
+	CpuQuota:             "50000",
+	Cpuset:               "1",
+	PidsLimit:            "-1",
+	BlkioThrottleReadBps: []ThrottleDevice{{Major: 8, Minor: 0, Rate: 1048576}},
+}
+
+func TestCgroupManagerV1(t *testing.T) {
+	fs, dir := newFakeCgroupFS(t, CGROUP_V1, false)
+	defer os.RemoveAll(dir)
+	cgroupManager := NewCgroupManagerWithFS("dicker/test", fs)
+
+	if err := cgroupManager.Set(fakeResourceConfig); err != nil {
+		t.Fatalf("Set() error %v", err)
+	}
+	wants := map[string]string{
+		"memory/dicker/test/memory.limit_in_bytes":         "67108864",
+		"memory/dicker/test/memory.memsw.limit_in_bytes":   "134217728",
+		"memory/dicker/test/memory.soft_limit_in_bytes":    "33554432",
+		"cpu/dicker/test/cpu.shares":                       "1024",
+		"cpu/dicker/test/cpu.cfs_period_us":                "100000",
+		"cpu/dicker/test/cpu.cfs_quota_us":                 "50000",
+		"cpuset/dicker/cpuset.cpus":                        "0-3",
+		"cpuset/dicker/cpuset.mems":                        "0",
+		"cpuset/dicker/test/cpuset.cpus":                   "1",
+		"cpuset/dicker/test/cpuset.mems":                   "0",
+		"pids/dicker/test/pids.max":                        "max",
+		"blkio/dicker/test/blkio.throttle.read_bps_device": "8:0 1048576",
+	}
+	for name, want := range wants {
+		if got := readFakeFile(t, filepath.Join(dir, name)); got != want {
+			t.Errorf("%s = %s, want %s", name, got, want)
+		}
+	}
+
+	if err := cgroupManager.Apply(12345); err != nil {
+		t.Fatalf("Apply() error %v", err)
+	}
+	for _, subsystem := range fakeSubsystemsV1 {
+		name := filepath.Join(subsystem, "dicker/test/cgroup.procs")
+		if got := readFakeFile(t, filepath.Join(dir, name)); got != "12345" {
+			t.Errorf("%s = %s, want 12345", name, got)
+		}
+	}
+	pids, err := cgroupManager.GetPids()
+	if err != nil {
+		t.Fatalf("GetPids() error %v", err)
+	}
+	if len(pids) != 1 || pids[0] != 12345 {
+		t.Errorf("GetPids() = %v, want [12345]", pids)
+	}
+
+	// cpuacct sets nothing and only reports the usage.
+	if err := ioutil.WriteFile(filepath.Join(dir, "cpuacct/dicker/test/cpuacct.usage"), []byte("42\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() error %v", err)
+	}
+	stats := &Stats{}
+	for _, subsystem := range cgroupManager.subsystems {
+		if subsystem.Name() != "cpuacct" {
+			continue
+		}
+		if err := subsystem.(statsGetter).GetStats(cgroupManager.Path, stats); err != nil {
+			t.Fatalf("GetStats() of subsystem cpuacct error %v", err)
+		}
+	}
+	if stats.CpuUsage != 42 {
+		t.Errorf("CpuUsage = %d, want 42", stats.CpuUsage)
+	}
+
+	// The subsystem is not mounted.
+	if err := cgroupManager.Set(&ResourceConfig{HugetlbLimits: []HugetlbLimit{{PageSize: "2MB", Limit: 1 << 30}}}); err == nil {
+		t.Errorf("Set() hugetlb limit error = nil, want error")
+	}
+
+	if err := cgroupManager.Freeze(); err != nil {
+		t.Fatalf("Freeze() error %v", err)
+	}
+	if got := readFakeFile(t, filepath.Join(dir, "freezer/dicker/test/freezer.state")); got != FREEZER_STATE_FROZEN {
+		t.Errorf("freezer.state = %s, want %s", got, FREEZER_STATE_FROZEN)
+	}
+	if err := cgroupManager.Thaw(); err != nil {
+		t.Fatalf("Thaw() error %v", err)
+	}
+
+	clearFakeProcs(t, dir)
+	if err := cgroupManager.Destroy(); err != nil {
+		t.Fatalf("Destroy() error %v", err)
+	}
+	for _, subsystem := range fakeSubsystemsV1 {
+		if _, err := os.Stat(filepath.Join(dir, subsystem, "dicker/test")); !os.IsNotExist(err) {
+			t.Errorf("Cgroup of subsystem %s is not removed", subsystem)
+		}
+	}
+}
+
+func TestCgroupManagerV1Hugetlb(t *testing.T) {
+	fs, dir := newFakeCgroupFS(t, CGROUP_V1, true)
+	defer os.RemoveAll(dir)
+	cgroupManager := NewCgroupManagerWithFS("dicker/test", fs)
+
+	res := &ResourceConfig{HugetlbLimits: []HugetlbLimit{{PageSize: "2MB", Limit: 1 << 30}, {PageSize: "1GB", Limit: 0}}}
+	if err := cgroupManager.Set(res); err != nil {
+		t.Fatalf("Set() error %v", err)
+	}
+	wants := map[string]string{
+		"hugetlb/dicker/test/hugetlb.2MB.limit_in_bytes": "1073741824",
+		"hugetlb/dicker/test/hugetlb.1GB.limit_in_bytes": "0",
+	}
+	for name, want := range wants {
+		if got := readFakeFile(t, filepath.Join(dir, name)); got != want {
+			t.Errorf("%s = %s, want %s", name, got, want)
+		}
+	}
+
+	if err := cgroupManager.Apply(12345); err != nil {
+		t.Fatalf("Apply() error %v", err)
+	}
+	if got := readFakeFile(t, filepath.Join(dir, "hugetlb/dicker/test/cgroup.procs")); got != "12345" {
+		t.Errorf("hugetlb cgroup.procs = %s, want 12345", got)
+	}
+
+	clearFakeProcs(t, dir)
+	if err := cgroupManager.Destroy(); err != nil {
+		t.Fatalf("Destroy() error %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "hugetlb/dicker/test")); !os.IsNotExist(err) {
+		t.Errorf("Cgroup of subsystem hugetlb is not removed")
+	}
+}
+
+func TestCgroupManagerV2(t *testing.T) {
+	fs, dir := newFakeCgroupFS(t, CGROUP_V2, false)
+	defer os.RemoveAll(dir)
+	cgroupManager := NewCgroupManagerWithFS("dicker/test", fs)
+
+	if err := os.Mkdir(filepath.Join(dir, "dicker"), 0755); err != nil {
+		t.Fatalf("Mkdir() error %v", err)
+	}
+	subtreeControls := map[string]func() []string{}
+	for _, name := range []string{"cgroup.subtree_control", "dicker/cgroup.subtree_control"} {
+		subtreeControls[name] = recordFakeSubtreeControl(t, filepath.Join(dir, name))
+	}
+
+	res := *fakeResourceConfig
+	res.HugetlbLimits = []HugetlbLimit{{PageSize: "2MB", Limit: 1 << 30}}
+	if err := cgroupManager.Set(&res); err != nil {
+		t.Fatalf("Set() error %v", err)
+	}
+	wants := map[string]string{
+		"dicker/test/memory.max":      "67108864",
+		"dicker/test/memory.swap.max": "67108864",
+		"dicker/test/memory.low":      "33554432",
+		"dicker/test/cpu.weight":      "39",
+		"dicker/test/cpu.max":         "50000 100000",
+		"dicker/test/cpuset.cpus":     "1",
+		"dicker/test/pids.max":        "max",
+		"dicker/test/io.max":          "8:0 rbps=1048576",
+		"dicker/test/hugetlb.2MB.max": "1073741824",
+	}
+	for name, want := range wants {
+		if got := readFakeFile(t, filepath.Join(dir, name)); got != want {
+			t.Errorf("%s = %s, want %s", name, got, want)
+		}
+	}
+
+	if err := cgroupManager.Apply(12345); err != nil {
+		t.Fatalf("Apply() error %v", err)
+	}
+	if got := readFakeFile(t, filepath.Join(dir, "dicker/test/cgroup.procs")); got != "12345" {
+		t.Errorf("cgroup.procs = %s, want 12345", got)
+	}
+	// Every controller is enabled on every ancestor.
+	for name, stop := range subtreeControls {
+		enabled := map[string]bool{}
+		for _, controller := range stop() {
+			enabled[controller] = true
+		}
+		for _, controller := range []string{"+memory", "+cpu", "+cpuset", "+pids", "+io", "+hugetlb"} {
+			if !enabled[controller] {
+				t.Errorf("%s is not written to %s", controller, name)
+			}
+		}
+	}
+
+	// The kernel reports the state in cgroup.events.
+	eventsFilePath := filepath.Join(dir, "dicker/test/cgroup.events")
+	if err := ioutil.WriteFile(eventsFilePath, []byte("populated 1\nfrozen 1\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() error %v", err)
+	}
+	if err := cgroupManager.Freeze(); err != nil {
+		t.Fatalf("Freeze() error %v", err)
+	}
+	if got := readFakeFile(t, filepath.Join(dir, "dicker/test/cgroup.freeze")); got != "1" {
+		t.Errorf("cgroup.freeze = %s, want 1", got)
+	}
+	if frozen, err := cgroupManager.Frozen(); err != nil || !frozen {
+		t.Errorf("Frozen() = %v, %v, want true", frozen, err)
+	}
+	if err := ioutil.WriteFile(eventsFilePath, []byte("populated 1\nfrozen 0\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() error %v", err)
+	}
+	if err := cgroupManager.Thaw(); err != nil {
+		t.Fatalf("Thaw() error %v", err)
+	}
+	if got := readFakeFile(t, filepath.Join(dir, "dicker/test/cgroup.freeze")); got != "0" {
+		t.Errorf("cgroup.freeze = %s, want 0", got)
+	}
+	if frozen, err := cgroupManager.Frozen(); err != nil || frozen {
+		t.Errorf("Frozen() = %v, %v, want false", frozen, err)
+	}
+
+	clearFakeProcs(t, dir)
+	if err := cgroupManager.Destroy(); err != nil {
+		t.Fatalf("Destroy() error %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "dicker/test")); !os.IsNotExist(err) {
+		t.Errorf("Cgroup is not removed")
+	}
+}
+
+// Updating the memory limit writes the saved memory plus swap limit again,
+// and a memory limit above it changes nothing.
+func TestCgroupManagerMemoryUpdate(t *testing.T) {
+	tests := []struct {
+		version int
+		wants   map[string]string
+	}{
+		{CGROUP_V1, map[string]string{
+			"memory/dicker/test/memory.limit_in_bytes":       "100663296",
+			"memory/dicker/test/memory.memsw.limit_in_bytes": "134217728",
+		}},
+		{CGROUP_V2, map[string]string{
+			"dicker/test/memory.max":      "100663296",
+			"dicker/test/memory.swap.max": "33554432",
+		}},
+	}
+	for _, tt := range tests {
+		fs, dir := newFakeCgroupFS(t, tt.version, false)
+		defer os.RemoveAll(dir)
+		cgroupManager := NewCgroupManagerWithFS("dicker/test", fs)
+		if err := cgroupManager.Set(&ResourceConfig{MemoryLimit: "67108864", MemorySwap: "134217728"}); err != nil {
+			t.Fatalf("Set() v%d error %v", tt.version, err)
+		}
+
+		if err := cgroupManager.Set(&ResourceConfig{MemoryLimit: "100663296", MemorySwap: "134217728"}); err != nil {
+			t.Fatalf("Set() v%d raised memory limit error %v", tt.version, err)
+		}
+		for name, want := range tt.wants {
+			if got := readFakeFile(t, filepath.Join(dir, name)); got != want {
+				t.Errorf("v%d %s = %s, want %s", tt.version, name, got, want)
+			}
+		}
+
+		if err := cgroupManager.Set(&ResourceConfig{MemoryLimit: "268435456", MemorySwap: "134217728"}); err == nil {
+			t.Errorf("Set() v%d memory limit above memory plus swap limit error = nil, want error", tt.version)
+		}
+		for name, want := range tt.wants {
+			if got := readFakeFile(t, filepath.Join(dir, name)); got != want {
+				t.Errorf("v%d %s = %s after refused update, want %s", tt.version, name, got, want)
+			}
+		}
+	}
+}
+
+func Test_convertCpuSharesToWeight(t *testing.T) {
+	tests := []struct {
+		shares uint64
+		want   uint64
+	}{
+		{shares: 0, want: 0},
+		{shares: 2, want: 1},
+		{shares: 1024, want: 39},
+		{shares: 262144, want: 10000},
+		{shares: 1000000, want: 10000},
+	}
+	for _, tt := range tests {
+		if got := convertCpuSharesToWeight(tt.shares); got != tt.want {
+			t.Errorf("convertCpuSharesToWeight(%d) = %d, want %d", tt.shares, got, tt.want)
+		}
+	}
+}
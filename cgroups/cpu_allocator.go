@@ -0,0 +1,397 @@
+package cgroups
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	DEFAULT_CPU_ALLOCATOR_PATH = "/var/run/dicker/cgroups/cpus.json"
+	DEFAULT_NODE_DIR_PATH      = "/sys/devices/system/node"
+	DEFAULT_CPU_ONLINE_PATH    = "/sys/devices/system/cpu/online"
+	// The largest NR_CPUS the kernel can be built with. A CPU list naming
+	// more CPUs is refused before its ranges are expanded.
+	MAX_CPUS = 8192
+)
+
+type CpuAllocator struct {
+	// The path of the JSON format storage file of the allocated CPUs.
+	AllocatorPath string
+	// The directory containing the NUMA nodes, like node0/cpulist.
+	NodeDirPath string
+	// The list of online CPUs, used when there is no NUMA information.
+	CpuOnlinePath string
+	// Allocation table, keys are the owners and values are the CPUs
+	// exclusively allocated to them.
+	Allocations map[string][]int
+	// Keys are the owners and values are the CPUs they use without exclusive
+	// allocation, which are never allocated exclusively to others.
+	Shared map[string][]int
+}
+
+// The format of the storage file.
+type cpuAllocatorState struct {
+	Allocations map[string][]int `json:"allocations"`
+	Shared      map[string][]int `json:"shared"`
+}
+
+var CpusAllocator = &CpuAllocator{
+	AllocatorPath: DEFAULT_CPU_ALLOCATOR_PATH,
+	NodeDirPath:   DEFAULT_NODE_DIR_PATH,
+	CpuOnlinePath: DEFAULT_CPU_ONLINE_PATH,
+}
+
+// Allocate n CPUs neither allocated to nor shared by anyone else to owner.
+// CPUs on a single NUMA node are preferred, and among the nodes able to hold
+// all of them, the one with the fewest free CPUs is used to keep larger
+// blocks for later allocations.
+func (a *CpuAllocator) Alloc(owner string, n int) ([]int, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("Invalid number of CPUs %d", n)
+	}
+
+	unlock, err := a.lock()
+	if err != nil {
+		return nil, fmt.Errorf("lock() error %v", err)
+	}
+	defer unlock()
+
+	if err := a.load(); err != nil {
+		return nil, fmt.Errorf("load() error %v", err)
+	}
+	if _, exist := a.Allocations[owner]; exist {
+		return nil, fmt.Errorf("CPUs are already allocated to %s", owner)
+	}
+
+	nodes, err := a.readNodes()
+	if err != nil {
+		return nil, fmt.Errorf("readNodes() error %v", err)
+	}
+
+	allocated := map[int]bool{}
+	for _, cpus := range a.Allocations {
+		for _, cpu := range cpus {
+			allocated[cpu] = true
+		}
+	}
+	for _, cpus := range a.Shared {
+		for _, cpu := range cpus {
+			allocated[cpu] = true
+		}
+	}
+	var freeNodes [][]int
+	total := 0
+	for _, node := range nodes {
+		var free []int
+		for _, cpu := range node {
+			if !allocated[cpu] {
+				free = append(free, cpu)
+			}
+		}
+		if len(free) != 0 {
+			freeNodes = append(freeNodes, free)
+			total += len(free)
+		}
+	}
+	if total < n {
+		return nil, fmt.Errorf("Only %d of %d requested CPUs are free", total, n)
+	}
+
+	var cpus []int
+	best := -1
+	for i, free := range freeNodes {
+		if len(free) >= n && (best < 0 || len(free) < len(freeNodes[best])) {
+			best = i
+		}
+	}
+	if best >= 0 {
+		cpus = append(cpus, freeNodes[best][:n]...)
+	} else {
+		// Span as few nodes as possible.
+		sort.SliceStable(freeNodes, func(i, j int) bool {
+			return len(freeNodes[i]) > len(freeNodes[j])
+		})
+		for _, free := range freeNodes {
+			if len(free) > n-len(cpus) {
+				free = free[:n-len(cpus)]
+			}
+			cpus = append(cpus, free...)
+			if len(cpus) == n {
+				break
+			}
+		}
+	}
+	sort.Ints(cpus)
+
+	a.Allocations[owner] = cpus
+	if err := a.dump(); err != nil {
+		return nil, fmt.Errorf("dump() error %v", err)
+	}
+
+	return cpus, nil
+}
+
+// Record that owner uses cpus without exclusive allocation, replacing the
+// previous record of owner.
+// It fails if any of them is exclusively allocated to someone else.
+func (a *CpuAllocator) Share(owner string, cpus []int) error {
+	unlock, err := a.lock()
+	if err != nil {
+		return fmt.Errorf("lock() error %v", err)
+	}
+	defer unlock()
+
+	if err := a.load(); err != nil {
+		return fmt.Errorf("load() error %v", err)
+	}
+	allocated := map[int]string{}
+	for allocOwner, allocation := range a.Allocations {
+		for _, cpu := range allocation {
+			allocated[cpu] = allocOwner
+		}
+	}
+	for _, cpu := range cpus {
+		if allocOwner, exist := allocated[cpu]; exist && allocOwner != owner {
+			return fmt.Errorf("CPU %d is exclusively allocated to %s", cpu, allocOwner)
+		}
+	}
+
+	if len(cpus) == 0 {
+		delete(a.Shared, owner)
+	} else {
+		a.Shared[owner] = cpus
+	}
+	if err := a.dump(); err != nil {
+		return fmt.Errorf("dump() error %v", err)
+	}
+
+	return nil
+}
+
+// Release the CPUs allocated to or shared by owner.
+// Nothing happens if there are none.
+func (a *CpuAllocator) Release(owner string) error {
+	unlock, err := a.lock()
+	if err != nil {
+		return fmt.Errorf("lock() error %v", err)
+	}
+	defer unlock()
+
+	if err := a.load(); err != nil {
+		return fmt.Errorf("load() error %v", err)
+	}
+	_, allocated := a.Allocations[owner]
+	_, shared := a.Shared[owner]
+	if !allocated && !shared {
+		return nil
+	}
+	delete(a.Allocations, owner)
+	delete(a.Shared, owner)
+
+	if err := a.dump(); err != nil {
+		return fmt.Errorf("dump() error %v", err)
+	}
+
+	return nil
+}
+
+// Return the CPUs exclusively allocated to owner, and all the exclusively
+// allocated CPUs if owner is empty.
+func (a *CpuAllocator) Allocated(owner string) ([]int, error) {
+	unlock, err := a.lock()
+	if err != nil {
+		return nil, fmt.Errorf("lock() error %v", err)
+	}
+	defer unlock()
+
+	if err := a.load(); err != nil {
+		return nil, fmt.Errorf("load() error %v", err)
+	}
+	if len(owner) != 0 {
+		return a.Allocations[owner], nil
+	}
+	var cpus []int
+	for _, allocation := range a.Allocations {
+		cpus = append(cpus, allocation...)
+	}
+	sort.Ints(cpus)
+
+	return cpus, nil
+}
+
+// Read the CPUs of each NUMA node.
+// All the online CPUs are regarded as one node if the kernel has no NUMA
+// support.
+func (a *CpuAllocator) readNodes() ([][]int, error) {
+	nodeDirPaths, err := filepath.Glob(filepath.Join(a.NodeDirPath, "node[0-9]*"))
+	if err != nil {
+		return nil, fmt.Errorf("Glob() %s error %v", a.NodeDirPath, err)
+	}
+	// node10 should come after node9.
+	sort.Slice(nodeDirPaths, func(i, j int) bool {
+		ni, _ := strconv.Atoi(strings.TrimPrefix(filepath.Base(nodeDirPaths[i]), "node"))
+		nj, _ := strconv.Atoi(strings.TrimPrefix(filepath.Base(nodeDirPaths[j]), "node"))
+		return ni < nj
+	})
+
+	var nodes [][]int
+	for _, nodeDirPath := range nodeDirPaths {
+		cpuListFilePath := filepath.Join(nodeDirPath, "cpulist")
+		cpus, err := readCpuListFile(cpuListFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("readCpuListFile() %s error %v", cpuListFilePath, err)
+		}
+		// Memory-only nodes have no CPUs.
+		if len(cpus) != 0 {
+			nodes = append(nodes, cpus)
+		}
+	}
+	if len(nodes) != 0 {
+		return nodes, nil
+	}
+
+	cpus, err := readCpuListFile(a.CpuOnlinePath)
+	if err != nil {
+		return nil, fmt.Errorf("readCpuListFile() %s error %v", a.CpuOnlinePath, err)
+	}
+	if len(cpus) == 0 {
+		return nil, fmt.Errorf("No online CPU found in %s", a.CpuOnlinePath)
+	}
+
+	return [][]int{cpus}, nil
+}
+
+func readCpuListFile(filePath string) ([]int, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("ReadFile() %s error %v", filePath, err)
+	}
+
+	return ParseCpuList(string(content))
+}
+
+// Parse a CPU list of the kernel format, like 0-2,4.
+// The CPU ids must be less than MAX_CPUS.
+func ParseCpuList(cpuList string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(strings.TrimSpace(cpuList), ",") {
+		if len(part) == 0 {
+			continue
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil || first < 0 || first >= MAX_CPUS {
+			return nil, fmt.Errorf("Invalid CPU list %s", cpuList)
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(bounds[1])
+			if err != nil || last < first || last >= MAX_CPUS {
+				return nil, fmt.Errorf("Invalid CPU list %s", cpuList)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+
+	return cpus, nil
+}
+
+// Format sorted CPUs as a CPU list of the kernel format, like 0-2,4.
+func FormatCpuList(cpus []int) string {
+	var parts []string
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(cpus[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		}
+		i = j + 1
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// Take an exclusive lock on a file next to the storage file, so that
+// concurrent dicker processes never hand out the same CPU.
+func (a *CpuAllocator) lock() (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(a.AllocatorPath), 0755); err != nil {
+		return nil, fmt.Errorf("MkdirAll() %s error %v", filepath.Dir(a.AllocatorPath), err)
+	}
+	lockFilePath := a.AllocatorPath + ".lock"
+	lockFile, err := os.OpenFile(lockFilePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("OpenFile() %s error %v", lockFilePath, err)
+	}
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		lockFile.Close()
+		return nil, fmt.Errorf("Flock() %s error %v", lockFilePath, err)
+	}
+
+	return func() {
+		syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+		lockFile.Close()
+	}, nil
+}
+
+func (a *CpuAllocator) load() error {
+	a.Allocations = map[string][]int{}
+	a.Shared = map[string][]int{}
+
+	jsonBytes, err := ioutil.ReadFile(a.AllocatorPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("ReadFile() %s error %v", a.AllocatorPath, err)
+	}
+	if len(jsonBytes) == 0 {
+		return nil
+	}
+
+	state := &cpuAllocatorState{}
+	if err := json.Unmarshal(jsonBytes, state); err != nil {
+		return fmt.Errorf("Unmarshal() error %v", err)
+	}
+	if state.Allocations != nil {
+		a.Allocations = state.Allocations
+	}
+	if state.Shared != nil {
+		a.Shared = state.Shared
+	}
+
+	return nil
+}
+
+func (a *CpuAllocator) dump() error {
+	state := &cpuAllocatorState{
+		Allocations: a.Allocations,
+		Shared:      a.Shared,
+	}
+	jsonBytes, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("Marshal() %v error %v", state, err)
+	}
+
+	tmpFilePath := fmt.Sprintf("%s.%d.tmp", a.AllocatorPath, os.Getpid())
+	if err := ioutil.WriteFile(tmpFilePath, jsonBytes, 0644); err != nil {
+		return fmt.Errorf("WriteFile() %s error %v", tmpFilePath, err)
+	}
+	if err := os.Rename(tmpFilePath, a.AllocatorPath); err != nil {
+		return fmt.Errorf("Rename() %s to %s error %v", tmpFilePath, a.AllocatorPath, err)
+	}
+
+	return nil
+}
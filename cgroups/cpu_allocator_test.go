@@ -0,0 +1,124 @@
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseCpuList(t *testing.T) {
+	tests := []struct {
+		cpuList string
+		want    []int
+		wantErr bool
+	}{
+		{"0", []int{0}, false},
+		{"0-2,4\n", []int{0, 1, 2, 4}, false},
+		{"", nil, false},
+		{"2-1", nil, true},
+		{"a", nil, true},
+		{"8191", []int{8191}, false},
+		{"8192", nil, true},
+		{"0-2147483647", nil, true},
+		{"0-9223372036854775807", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cpuList, func(t *testing.T) {
+			got, err := ParseCpuList(tt.cpuList)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseCpuList() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseCpuList() = %v, want %v", got, tt.want)
+			}
+			if !tt.wantErr && FormatCpuList(got) != FormatCpuList(tt.want) {
+				t.Errorf("FormatCpuList() = %v", FormatCpuList(got))
+			}
+		})
+	}
+
+	if got := FormatCpuList([]int{0, 1, 2, 4, 6, 7}); got != "0-2,4,6-7" {
+		t.Errorf("FormatCpuList() = %v, want 0-2,4,6-7", got)
+	}
+}
+
+func TestCpuAllocator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dicker_cpu_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// node0 has CPUs 0-3, node1 has CPUs 4-5, and node2 has memory only.
+	for node, cpuList := range map[string]string{"node0": "0-3", "node1": "4-5", "node2": ""} {
+		nodeDirPath := filepath.Join(dir, "node", node)
+		if err := os.MkdirAll(nodeDirPath, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(nodeDirPath, "cpulist"), []byte(cpuList+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	allocator := &CpuAllocator{
+		AllocatorPath: filepath.Join(dir, "cpus.json"),
+		NodeDirPath:   filepath.Join(dir, "node"),
+	}
+
+	// Steps run in order on the same allocator.
+	tests := []struct {
+		name    string
+		owner   string
+		n       int
+		share   []int
+		release bool
+		want    []int
+		wantErr bool
+	}{
+		{name: "share", owner: "e", share: []int{3}},
+		{name: "best fitting node", owner: "a", n: 2, want: []int{4, 5}},
+		{name: "remaining node", owner: "b", n: 3, want: []int{0, 1, 2}},
+		{name: "allocated owner", owner: "b", n: 1, wantErr: true},
+		{name: "not enough", owner: "c", n: 2, wantErr: true},
+		{name: "share allocated", owner: "f", share: []int{2, 3}, wantErr: true},
+		{name: "release", owner: "a", release: true},
+		{name: "release shared", owner: "e", release: true},
+		{name: "span nodes", owner: "c", n: 3, want: []int{3, 4, 5}},
+		{name: "invalid number", owner: "d", n: 0, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.release {
+				if err := allocator.Release(tt.owner); err != nil {
+					t.Errorf("CpuAllocator.Release() error = %v", err)
+				}
+				return
+			}
+			if tt.share != nil {
+				if err := allocator.Share(tt.owner, tt.share); (err != nil) != tt.wantErr {
+					t.Errorf("CpuAllocator.Share() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			got, err := allocator.Alloc(tt.owner, tt.n)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CpuAllocator.Alloc() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CpuAllocator.Alloc() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The allocations are persisted.
+	got, err := (&CpuAllocator{AllocatorPath: allocator.AllocatorPath}).Allocated("")
+	if err != nil {
+		t.Fatalf("CpuAllocator.Allocated() error = %v", err)
+	}
+	if want := []int{0, 1, 2, 3, 4, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CpuAllocator.Allocated() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+package cgroups
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Locate the hierarchies of the subsystems, so that cgroups can be managed in
+// a tree other than the one mounted on the host.
+type CgroupFS interface {
+	// Return CGROUP_V1 or CGROUP_V2.
+	Version() int
+	// Return the root of the hierarchy the subsystem is attached to, or empty
+	// if it is not mounted.
+	// All the subsystems share the same root on v2.
+	Root(subsystem string) string
+}
+
+// The hierarchies mounted on the host, found in /proc/self/mountinfo.
+type hostCgroupFS struct {
+	version int
+}
+
+func (fs *hostCgroupFS) Version() int {
+	return fs.version
+}
+
+func (fs *hostCgroupFS) Root(subsystem string) string {
+	if fs.version == CGROUP_V2 {
+		return FindCgroup2MountPoint()
+	}
+	return FindCgroupMountPoint(subsystem)
+}
+
+// The hierarchies in a directory laid out like /sys/fs/cgroup.
+// On v1 every subsystem is in the sub directory of its name, and on v2 the
+// directory is the unified hierarchy.
+type dirCgroupFS struct {
+	dir     string
+	version int
+}
+
+func NewDirCgroupFS(dir string, version int) CgroupFS {
+	return &dirCgroupFS{
+		dir:     dir,
+		version: version,
+	}
+}
+
+func (fs *dirCgroupFS) Version() int {
+	return fs.version
+}
+
+func (fs *dirCgroupFS) Root(subsystem string) string {
+	if fs.version == CGROUP_V2 {
+		return fs.dir
+	}
+
+	root := filepath.Join(fs.dir, subsystem)
+	if _, err := os.Stat(root); err != nil {
+		return ""
+	}
+	return root
+}
@@ -0,0 +1,393 @@
+package cgroups
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Resource usage of a cgroup.
+type Stats struct {
+	MemoryUsage uint64 // Memory usage in bytes, without the inactive file cache.
+	MemoryLimit uint64 // Memory limit in bytes, 0 for unlimited.
+	CpuUsage    uint64 // Total CPU time consumed in nanoseconds.
+	PidsCurrent uint64 // Number of processes.
+	BlkioRead   uint64 // Bytes read from block devices.
+	BlkioWrite  uint64 // Bytes written to block devices.
+
+	// Pressure stall information, only available on v2 with PSI enabled.
+	CpuPressure    *Pressure
+	MemoryPressure *Pressure
+	IoPressure     *Pressure
+}
+
+// Share of wall time in which tasks are stalled on a resource.
+// Some is the time at least one task is stalled, and full is the time all
+// the non-idle tasks are stalled at the same time.
+type Pressure struct {
+	Some PressureValues `json:"some"`
+	Full PressureValues `json:"full"`
+}
+
+type PressureValues struct {
+	Avg10 float64 `json:"avg10"` // Percentage of the last 10 seconds.
+	Avg60 float64 `json:"avg60"` // Percentage of the last 60 seconds.
+	Total uint64  `json:"total"` // Total stall time in microseconds.
+}
+
+// Implemented by the subsystems providing usage statistics.
+type statsGetter interface {
+	GetStats(path string, stats *Stats) error
+}
+
+// Collect the resource usage of this cgroup from all the subsystems.
+func (c *CgroupManager) GetStats() (*Stats, error) {
+	stats := &Stats{}
+	for _, subsystem := range c.subsystems {
+		getter, ok := subsystem.(statsGetter)
+		if !ok || len(c.fs.Root(subsystem.Name())) == 0 {
+			continue
+		}
+		if err := getter.GetStats(c.Path, stats); err != nil {
+			return nil, fmt.Errorf("GetStats() cgroup %s of subsystem %s error %v", c.Path, subsystem.Name(), err)
+		}
+	}
+
+	return stats, nil
+}
+
+// Values no less than this are unlimited on v1.
+const UNLIMITED_THRESHOLD = 1 << 62
+
+func (s *MemorySubsystem) GetStats(path string, stats *Stats) error {
+	cgroupPath, err := s.getCgroupPath(path, false)
+	if err != nil {
+		return fmt.Errorf("getCgroupPath() of subsystem %s error %v", s.Name(), err)
+	}
+
+	usage, err := readUintFile(filepath.Join(cgroupPath, "memory.usage_in_bytes"))
+	if err != nil {
+		return err
+	}
+	limit, err := readUintFile(filepath.Join(cgroupPath, "memory.limit_in_bytes"))
+	if err != nil {
+		return err
+	}
+	memoryStat, err := readKeyValueFile(filepath.Join(cgroupPath, "memory.stat"))
+	if err != nil {
+		return err
+	}
+
+	stats.MemoryUsage = subtractInactiveFile(usage, memoryStat["total_inactive_file"])
+	if limit < UNLIMITED_THRESHOLD {
+		stats.MemoryLimit = limit
+	}
+
+	return nil
+}
+
+func (s *CpuacctSubsystem) GetStats(path string, stats *Stats) error {
+	cgroupPath, err := s.getCgroupPath(path, false)
+	if err != nil {
+		return fmt.Errorf("getCgroupPath() of subsystem %s error %v", s.Name(), err)
+	}
+
+	usage, err := readUintFile(filepath.Join(cgroupPath, "cpuacct.usage"))
+	if err != nil {
+		return err
+	}
+	stats.CpuUsage = usage
+
+	return nil
+}
+
+func (s *PidsSubsystem) GetStats(path string, stats *Stats) error {
+	cgroupPath, err := s.getCgroupPath(path, false)
+	if err != nil {
+		return fmt.Errorf("getCgroupPath() of subsystem %s error %v", s.Name(), err)
+	}
+
+	current, err := readUintFile(filepath.Join(cgroupPath, "pids.current"))
+	if err != nil {
+		return err
+	}
+	stats.PidsCurrent = current
+
+	return nil
+}
+
+func (s *BlkioSubsystem) GetStats(path string, stats *Stats) error {
+	cgroupPath, err := s.getCgroupPath(path, false)
+	if err != nil {
+		return fmt.Errorf("getCgroupPath() of subsystem %s error %v", s.Name(), err)
+	}
+
+	filePath := filepath.Join(cgroupPath, "blkio.throttle.io_service_bytes_recursive")
+	contentBytes, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("ReadFile() %s error %v", filePath, err)
+	}
+
+	// The content is like:
+	// 8:0 Read 102400
+	// 8:0 Write 18243584
+	// ...
+	// Total 93675520
+	for _, line := range strings.Split(string(contentBytes), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		val, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("ParseUint() %s error %v", fields[2], err)
+		}
+		switch fields[1] {
+		case "Read":
+			stats.BlkioRead += val
+		case "Write":
+			stats.BlkioWrite += val
+		}
+	}
+
+	return nil
+}
+
+func (s *MemorySubsystemV2) GetStats(path string, stats *Stats) error {
+	cgroupPath, err := s.getCgroupPath(path, false)
+	if err != nil {
+		return fmt.Errorf("getCgroupPath() of subsystem %s error %v", s.Name(), err)
+	}
+
+	if stats.MemoryPressure, err = readPressureFile(filepath.Join(cgroupPath, "memory.pressure")); err != nil {
+		return err
+	}
+
+	// The files only exist if the controller is enabled by the parent.
+	usageFilePath := filepath.Join(cgroupPath, "memory.current")
+	if _, err := os.Stat(usageFilePath); os.IsNotExist(err) {
+		return nil
+	}
+	usage, err := readUintFile(usageFilePath)
+	if err != nil {
+		return err
+	}
+	memoryStat, err := readKeyValueFile(filepath.Join(cgroupPath, "memory.stat"))
+	if err != nil {
+		return err
+	}
+	stats.MemoryUsage = subtractInactiveFile(usage, memoryStat["inactive_file"])
+
+	// The limit is 'max' if unlimited.
+	limitFilePath := filepath.Join(cgroupPath, "memory.max")
+	if limit, err := readUintFile(limitFilePath); err == nil {
+		stats.MemoryLimit = limit
+	}
+
+	return nil
+}
+
+// The CPU usage is always available in cpu.stat on v2.
+func (s *CpuSubsystemV2) GetStats(path string, stats *Stats) error {
+	cgroupPath, err := s.getCgroupPath(path, false)
+	if err != nil {
+		return fmt.Errorf("getCgroupPath() of subsystem %s error %v", s.Name(), err)
+	}
+
+	cpuStat, err := readKeyValueFile(filepath.Join(cgroupPath, "cpu.stat"))
+	if err != nil {
+		return err
+	}
+	stats.CpuUsage = cpuStat["usage_usec"] * 1000
+
+	if stats.CpuPressure, err = readPressureFile(filepath.Join(cgroupPath, "cpu.pressure")); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *PidsSubsystemV2) GetStats(path string, stats *Stats) error {
+	cgroupPath, err := s.getCgroupPath(path, false)
+	if err != nil {
+		return fmt.Errorf("getCgroupPath() of subsystem %s error %v", s.Name(), err)
+	}
+
+	filePath := filepath.Join(cgroupPath, "pids.current")
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil
+	}
+	current, err := readUintFile(filePath)
+	if err != nil {
+		return err
+	}
+	stats.PidsCurrent = current
+
+	return nil
+}
+
+func (s *IoSubsystemV2) GetStats(path string, stats *Stats) error {
+	cgroupPath, err := s.getCgroupPath(path, false)
+	if err != nil {
+		return fmt.Errorf("getCgroupPath() of subsystem %s error %v", s.Name(), err)
+	}
+
+	if stats.IoPressure, err = readPressureFile(filepath.Join(cgroupPath, "io.pressure")); err != nil {
+		return err
+	}
+
+	filePath := filepath.Join(cgroupPath, "io.stat")
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil
+	}
+	contentBytes, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("ReadFile() %s error %v", filePath, err)
+	}
+
+	// Each line is like:
+	// 8:0 rbytes=102400 wbytes=18243584 rios=25 wios=4453 dbytes=0 dios=0
+	for _, line := range strings.Split(string(contentBytes), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			val, err := strconv.ParseUint(kv[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("ParseUint() %s error %v", kv[1], err)
+			}
+			switch kv[0] {
+			case "rbytes":
+				stats.BlkioRead += val
+			case "wbytes":
+				stats.BlkioWrite += val
+			}
+		}
+	}
+
+	return nil
+}
+
+// The inactive file cache can be reclaimed, so it is not counted as usage.
+func subtractInactiveFile(usage, inactiveFile uint64) uint64 {
+	if inactiveFile > usage {
+		return 0
+	}
+	return usage - inactiveFile
+}
+
+// Return nil if the kernel has no PSI support or it is disabled.
+func readPressureFile(filePath string) (*Pressure, error) {
+	contentBytes, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) || errors.Is(err, syscall.EOPNOTSUPP) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ReadFile() %s error %v", filePath, err)
+	}
+
+	pressure, err := parsePressure(string(contentBytes))
+	if err != nil {
+		return nil, fmt.Errorf("parsePressure() %s error %v", filePath, err)
+	}
+
+	return pressure, nil
+}
+
+// The content is like:
+// some avg10=0.00 avg60=0.00 avg300=0.00 total=559
+// full avg10=0.00 avg60=0.00 avg300=0.00 total=414
+// The full line of cpu.pressure is absent on old kernels.
+func parsePressure(content string) (*Pressure, error) {
+	pressure := &Pressure{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var values *PressureValues
+		switch fields[0] {
+		case "some":
+			values = &pressure.Some
+		case "full":
+			values = &pressure.Full
+		default:
+			return nil, fmt.Errorf("Invalid line %s", line)
+		}
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("Invalid field %s", field)
+			}
+			var err error
+			switch kv[0] {
+			case "avg10":
+				values.Avg10, err = strconv.ParseFloat(kv[1], 64)
+			case "avg60":
+				values.Avg60, err = strconv.ParseFloat(kv[1], 64)
+			case "total":
+				values.Total, err = strconv.ParseUint(kv[1], 10, 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("Invalid field %s", field)
+			}
+		}
+	}
+
+	return pressure, nil
+}
+
+func readUintFile(filePath string) (uint64, error) {
+	contentBytes, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("ReadFile() %s error %v", filePath, err)
+	}
+
+	content := strings.TrimSpace(string(contentBytes))
+	val, err := strconv.ParseUint(content, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("ParseUint() %s of %s error %v", content, filePath, err)
+	}
+
+	return val, nil
+}
+
+// Read a file of lines like 'key value' into a map.
+func readKeyValueFile(filePath string) (map[string]uint64, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("Open() %s error %v", filePath, err)
+	}
+	defer f.Close()
+
+	kv := map[string]uint64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		val, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		kv[fields[0]] = val
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Scan() %s error %v", filePath, err)
+	}
+
+	return kv, nil
+}
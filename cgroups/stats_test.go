@@ -0,0 +1,52 @@
+package cgroups
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parsePressure(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *Pressure
+		wantErr bool
+	}{
+		{
+			name: "some and full",
+			content: "some avg10=1.50 avg60=0.25 avg300=0.00 total=559\n" +
+				"full avg10=0.50 avg60=0.00 avg300=0.00 total=414\n",
+			want: &Pressure{
+				Some: PressureValues{Avg10: 1.5, Avg60: 0.25, Total: 559},
+				Full: PressureValues{Avg10: 0.5, Total: 414},
+			},
+		},
+		{
+			name:    "some only",
+			content: "some avg10=0.00 avg60=0.00 avg300=0.00 total=7\n",
+			want:    &Pressure{Some: PressureValues{Total: 7}},
+		},
+		{
+			name:    "invalid line",
+			content: "none avg10=0.00\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid value",
+			content: "some avg10=x avg60=0.00 avg300=0.00 total=7\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePressure(tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parsePressure() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePressure() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,22 +6,72 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
-	"github.com/chengzeyi/dicker/util"
+	log "github.com/sirupsen/logrus"
 )
 
 type ResourceConfig struct {
-	MemoryLimit string
-	CpuShares   string
-	Cpuset      string
+	MemoryLimit            string           `json:"memory_limit"`              // Memory limit in bytes.
+	MemorySwap             string           `json:"memory_swap"`               // Memory plus swap limit in bytes, -1 for unlimited.
+	MemoryReservation      string           `json:"memory_reservation"`        // Memory soft limit in bytes.
+	CpuShares              string           `json:"cpu_shares"`                // Relative CPU weight.
+	CpuPeriod              string           `json:"cpu_period"`                // CFS period in microseconds.
+	CpuQuota               string           `json:"cpu_quota"`                 // CFS quota in microseconds per period.
+	Cpuset                 string           `json:"cpuset"`                    // CPUs allowed to use, like 0-2,4.
+	PidsLimit              string           `json:"pids_limit"`                // Maximum number of processes, -1 for unlimited.
+	BlkioThrottleReadBps   []ThrottleDevice `json:"blkio_throttle_read_bps"`   // Read bytes per second of devices.
+	BlkioThrottleWriteBps  []ThrottleDevice `json:"blkio_throttle_write_bps"`  // Write bytes per second of devices.
+	BlkioThrottleReadIops  []ThrottleDevice `json:"blkio_throttle_read_iops"`  // Read IO per second of devices.
+	BlkioThrottleWriteIops []ThrottleDevice `json:"blkio_throttle_write_iops"` // Write IO per second of devices.
+	HugetlbLimits          []HugetlbLimit   `json:"hugetlb_limits"`            // Huge page limits of page sizes.
 }
 
-var subsystems = []Subsystem{
-	&CpuSubsystem{},
-	&CpusetSubsystem{},
-	&MemorySubsystem{},
+// The IO rate limit of a block device.
+type ThrottleDevice struct {
+	Major int64  `json:"major"`
+	Minor int64  `json:"minor"`
+	Rate  uint64 `json:"rate"`
 }
 
+// The limit of huge page usage of a page size like 2MB.
+type HugetlbLimit struct {
+	PageSize string `json:"page_size"`
+	Limit    uint64 `json:"limit"`
+}
+
+func newSubsystemsV1(fs CgroupFS) []Subsystem {
+	return []Subsystem{
+		&CpuSubsystem{SubsystemBase{name: "cpu", fs: fs}},
+		&CpuacctSubsystem{SubsystemBase{name: "cpuacct", fs: fs}},
+		&CpusetSubsystem{SubsystemBase{name: "cpuset", fs: fs}},
+		&MemorySubsystem{SubsystemBase{name: "memory", fs: fs}},
+		&PidsSubsystem{SubsystemBase{name: "pids", fs: fs}},
+		&BlkioSubsystem{SubsystemBase{name: "blkio", fs: fs}},
+		&HugetlbSubsystem{SubsystemBase{name: "hugetlb", fs: fs}},
+		&FreezerSubsystem{SubsystemBase{name: "freezer", fs: fs}},
+	}
+}
+
+// Create the subsystems of the cgroup version of fs.
+func newSubsystems(fs CgroupFS) []Subsystem {
+	if fs.Version() == CGROUP_V2 {
+		return newSubsystemsV2(fs)
+	}
+	return newSubsystemsV1(fs)
+}
+
+const (
+	FREEZER_STATE_FROZEN   = "FROZEN"
+	FREEZER_STATE_THAWED   = "THAWED"
+	FREEZER_STATE_FREEZING = "FREEZING"
+
+	FREEZE_TIMEOUT       = 10 * time.Second
+	FREEZE_POLL_INTERVAL = 10 * time.Millisecond
+)
+
 type Subsystem interface {
 	Name() string
 	Set(path string, res *ResourceConfig) error
@@ -29,12 +79,22 @@ type Subsystem interface {
 	Remove(path string) error
 }
 
-type SubsystemBase struct{}
+// Methods of an embedded struct cannot call the methods of the outer struct,
+// so the name is stored here.
+type SubsystemBase struct {
+	name string
+	fs   CgroupFS
+}
 
 type CpuSubsystem struct {
 	SubsystemBase
 }
 
+// Only for accounting, so there is nothing to set.
+type CpuacctSubsystem struct {
+	SubsystemBase
+}
+
 type CpusetSubsystem struct {
 	SubsystemBase
 }
@@ -43,8 +103,34 @@ type MemorySubsystem struct {
 	SubsystemBase
 }
 
+type PidsSubsystem struct {
+	SubsystemBase
+}
+
+type BlkioSubsystem struct {
+	SubsystemBase
+}
+
+type HugetlbSubsystem struct {
+	SubsystemBase
+}
+
+type FreezerSubsystem struct {
+	SubsystemBase
+}
+
 func (s *SubsystemBase) Name() string {
-	panic("not implemented")
+	return s.name
+}
+
+// Return the root of the hierarchy of this subsystem, or empty if it is not
+// mounted.
+func (s *SubsystemBase) root() string {
+	return s.fs.Root(s.name)
+}
+
+func (s *SubsystemBase) getCgroupPath(path string, autoCreate bool) (string, error) {
+	return getCgroupPath(s.root(), s.name, path, autoCreate)
 }
 
 func (s *SubsystemBase) set(path, key, val string) error {
@@ -52,13 +138,18 @@ func (s *SubsystemBase) set(path, key, val string) error {
 		return nil
 	}
 
-	cgroupPath, err := util.GetCgroupPath(s.Name(), path, true)
+	cgroupPath, err := s.getCgroupPath(path, true)
 	if err != nil {
-		return fmt.Errorf("GetCgroupPath() of subsystem %s error %v", s.Name(), err)
+		return fmt.Errorf("getCgroupPath() of subsystem %s error %v", s.Name(), err)
 	}
 
 	filePath := filepath.Join(cgroupPath, key)
 	if err := ioutil.WriteFile(filePath, []byte(val), 0644); err != nil {
+		// The kernel refuses values it cannot apply, like a memory limit
+		// below the current usage.
+		if pathErr, ok := err.(*os.PathError); ok && (pathErr.Err == syscall.EBUSY || pathErr.Err == syscall.EINVAL) {
+			return fmt.Errorf("Kernel refuses to set %s of cgroup %s to %s: %v", key, path, val, pathErr.Err)
+		}
 		return fmt.Errorf("WriteFile() %s error %v", filePath, err)
 	}
 
@@ -66,24 +157,37 @@ func (s *SubsystemBase) set(path, key, val string) error {
 }
 
 func (s *SubsystemBase) Apply(path string, pid int) error {
-	cgroupPath, err := util.GetCgroupPath(s.Name(), path, false)
+	// Not every subsystem is mounted on every host, and a process cannot
+	// join the hierarchy of an unmounted one.
+	// Set fails instead if any limitation of it is required.
+	if len(s.root()) == 0 {
+		log.Warnf("Cgroup subsystem %s is not mounted, skip it", s.Name())
+		return nil
+	}
+
+	// The cgroup is not created by Set if there is no limitation of this subsystem.
+	cgroupPath, err := s.getCgroupPath(path, true)
 	if err != nil {
-		return fmt.Errorf("GetCgroupPath() of subsystem %s error %v", s.Name(), err)
+		return fmt.Errorf("getCgroupPath() of subsystem %s error %v", s.Name(), err)
 	}
 
-	tasksFilePath := filepath.Join(cgroupPath, "tasks")
-	if err := ioutil.WriteFile(tasksFilePath, []byte(strconv.Itoa(pid)), 0644); err != nil {
-		return fmt.Errorf("WriteFile %s error %v", tasksFilePath, err)
+	// Write cgroup.procs instead of tasks to move all the threads of the process.
+	procsFilePath := filepath.Join(cgroupPath, "cgroup.procs")
+	if err := ioutil.WriteFile(procsFilePath, []byte(strconv.Itoa(pid)), 0644); err != nil {
+		return fmt.Errorf("WriteFile %s error %v", procsFilePath, err)
 	}
 
 	return nil
 }
 
 func (s *SubsystemBase) Remove(path string) error {
-	cgroupPath, err := util.GetCgroupPath(s.Name(), path, false)
-	if err != nil {
-		return fmt.Errorf("GetCgroupPath() of subsystem %s error %v", s.Name(), err)
+	if len(s.root()) == 0 {
+		return nil
 	}
+
+	// Co-mounted subsystems like cpu,cpuacct share the same cgroup, and so do
+	// all the subsystems on v2, so it may have been removed by another one.
+	cgroupPath := filepath.Join(s.root(), path)
 	if err := os.RemoveAll(cgroupPath); err != nil {
 		return fmt.Errorf("RemoveAll() %s error %v", cgroupPath, err)
 	}
@@ -91,26 +195,298 @@ func (s *SubsystemBase) Remove(path string) error {
 	return nil
 }
 
-func (s *CpuSubsystem) Name() string {
-	return "cpu"
-}
-
 func (s *CpuSubsystem) Set(path string, res *ResourceConfig) error {
-	return s.set(path, "cpu.shares", res.CpuShares)
+	if err := s.set(path, "cpu.shares", res.CpuShares); err != nil {
+		return err
+	}
+	if err := s.set(path, "cpu.cfs_period_us", res.CpuPeriod); err != nil {
+		return err
+	}
+	return s.set(path, "cpu.cfs_quota_us", res.CpuQuota)
 }
 
-func (s *CpusetSubsystem) Name() string {
-	return "cpuset"
+func (s *CpuacctSubsystem) Set(path string, res *ResourceConfig) error {
+	return nil
 }
 
 func (s *CpusetSubsystem) Set(path string, res *ResourceConfig) error {
+	if err := s.initCpuset(path); err != nil {
+		return fmt.Errorf("initCpuset() %s error %v", path, err)
+	}
 	return s.set(path, "cpuset.cpus", res.Cpuset)
 }
 
-func (s *MemorySubsystem) Name() string {
-	return "memory"
+func (s *CpusetSubsystem) Apply(path string, pid int) error {
+	if err := s.initCpuset(path); err != nil {
+		return fmt.Errorf("initCpuset() %s error %v", path, err)
+	}
+	return s.SubsystemBase.Apply(path, pid)
+}
+
+// A newly created cpuset cgroup has empty cpuset.cpus and cpuset.mems, and
+// no process can join it until they are set.
+// Copy them from the parent cgroup for path and every ancestor of it.
+func (s *CpusetSubsystem) initCpuset(path string) error {
+	cgroupRoot := s.root()
+	if len(cgroupRoot) == 0 {
+		return fmt.Errorf("Cannot find the mount point of cgroup subsystem %s", s.Name())
+	}
+	if _, err := s.getCgroupPath(path, true); err != nil {
+		return fmt.Errorf("getCgroupPath() of subsystem %s error %v", s.Name(), err)
+	}
+
+	parentPath := cgroupRoot
+	for _, dir := range strings.Split(filepath.Clean(path), string(filepath.Separator)) {
+		if len(dir) == 0 {
+			continue
+		}
+		cgroupPath := filepath.Join(parentPath, dir)
+		for _, key := range []string{"cpuset.cpus", "cpuset.mems"} {
+			filePath := filepath.Join(cgroupPath, key)
+			// The file does not exist in a tree that is not a real cgroupfs.
+			contentBytes, err := ioutil.ReadFile(filePath)
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("ReadFile() %s error %v", filePath, err)
+			}
+			if len(strings.TrimSpace(string(contentBytes))) != 0 {
+				continue
+			}
+			parentFilePath := filepath.Join(parentPath, key)
+			parentContentBytes, err := ioutil.ReadFile(parentFilePath)
+			if err != nil {
+				return fmt.Errorf("ReadFile() %s error %v", parentFilePath, err)
+			}
+			if err := ioutil.WriteFile(filePath, parentContentBytes, 0644); err != nil {
+				return fmt.Errorf("WriteFile() %s error %v", filePath, err)
+			}
+		}
+		parentPath = cgroupPath
+	}
+
+	return nil
 }
 
 func (s *MemorySubsystem) Set(path string, res *ResourceConfig) error {
-	return s.set(path, "memory.limit_in_bytes", res.MemoryLimit)
+	// The memory plus swap limit cannot be less than the memory limit, so it
+	// is written first if the memory limit is raised, and last otherwise.
+	keys := []string{"memory.limit_in_bytes", "memory.memsw.limit_in_bytes"}
+	vals := []string{res.MemoryLimit, res.MemorySwap}
+	if len(res.MemoryLimit) != 0 && len(res.MemorySwap) != 0 {
+		// Refuse before anything is written, so that the cgroup is unchanged.
+		if _, err := convertMemorySwap(res.MemorySwap, res.MemoryLimit); err != nil {
+			return fmt.Errorf("convertMemorySwap() %s error %v", res.MemorySwap, err)
+		}
+		cgroupPath, err := s.getCgroupPath(path, true)
+		if err != nil {
+			return fmt.Errorf("getCgroupPath() of subsystem %s error %v", s.Name(), err)
+		}
+		// The file does not exist in a tree that is not a real cgroupfs.
+		filePath := filepath.Join(cgroupPath, "memory.limit_in_bytes")
+		contentBytes, err := ioutil.ReadFile(filePath)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("ReadFile() %s error %v", filePath, err)
+		}
+		current, err := strconv.ParseUint(strings.TrimSpace(string(contentBytes)), 10, 64)
+		memory, _ := strconv.ParseUint(res.MemoryLimit, 10, 64)
+		if err == nil && memory > current {
+			keys[0], keys[1] = keys[1], keys[0]
+			vals[0], vals[1] = vals[1], vals[0]
+		}
+	}
+	for i, key := range keys {
+		if err := s.set(path, key, vals[i]); err != nil {
+			return err
+		}
+	}
+	return s.set(path, "memory.soft_limit_in_bytes", res.MemoryReservation)
+}
+
+// Register an eventfd for memory.oom_control in cgroup.event_control, which is
+// signaled on every OOM event and when the cgroup is removed.
+func (s *MemorySubsystem) NotifyOOM(path string, done <-chan struct{}) (<-chan struct{}, error) {
+	cgroupPath, err := s.getCgroupPath(path, false)
+	if err != nil {
+		return nil, fmt.Errorf("getCgroupPath() of subsystem %s error %v", s.Name(), err)
+	}
+
+	oomControlFilePath := filepath.Join(cgroupPath, "memory.oom_control")
+	oomControlFile, err := os.Open(oomControlFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("Open() %s error %v", oomControlFilePath, err)
+	}
+	// Non-blocking so that closing the file interrupts the reading.
+	efd, _, errno := syscall.RawSyscall(syscall.SYS_EVENTFD2, 0, syscall.O_CLOEXEC|syscall.O_NONBLOCK, 0)
+	if errno != 0 {
+		oomControlFile.Close()
+		return nil, fmt.Errorf("eventfd2() error %v", errno)
+	}
+	eventFile := os.NewFile(efd, "eventfd")
+
+	// Use efd instead of eventFile.Fd(), which puts the file into blocking mode.
+	eventControlFilePath := filepath.Join(cgroupPath, "cgroup.event_control")
+	if err := ioutil.WriteFile(eventControlFilePath, []byte(fmt.Sprintf("%d %d", efd, oomControlFile.Fd())), 0644); err != nil {
+		eventFile.Close()
+		oomControlFile.Close()
+		return nil, fmt.Errorf("WriteFile() %s error %v", eventControlFilePath, err)
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		<-done
+		eventFile.Close()
+	}()
+	go func() {
+		defer close(ch)
+		defer oomControlFile.Close()
+		buf := make([]byte, 8)
+		for {
+			if _, err := eventFile.Read(buf); err != nil {
+				return
+			}
+			if _, err := os.Stat(cgroupPath); os.IsNotExist(err) {
+				return
+			}
+			select {
+			case ch <- struct{}{}:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// Read the oom_kill counter in memory.oom_control, which is the number of
+// processes in this cgroup killed by the OOM killer.
+func (s *MemorySubsystem) OOMKillCount(path string) (int, error) {
+	cgroupPath, err := s.getCgroupPath(path, false)
+	if err != nil {
+		return 0, fmt.Errorf("getCgroupPath() of subsystem %s error %v", s.Name(), err)
+	}
+
+	filePath := filepath.Join(cgroupPath, "memory.oom_control")
+	contentBytes, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("ReadFile() %s error %v", filePath, err)
+	}
+
+	// The content is like:
+	// oom_kill_disable 0
+	// under_oom 0
+	// oom_kill 0
+	for _, line := range strings.Split(string(contentBytes), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			count, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return 0, fmt.Errorf("Atoi() %s error %v", fields[1], err)
+			}
+			return count, nil
+		}
+	}
+
+	return 0, nil
+}
+
+func (s *PidsSubsystem) Set(path string, res *ResourceConfig) error {
+	return s.set(path, "pids.max", convertPidsLimit(res.PidsLimit))
+}
+
+// Both versions use 'max' for no limitation.
+func convertPidsLimit(limit string) string {
+	if len(limit) == 0 {
+		return ""
+	}
+	if n, err := strconv.ParseInt(limit, 10, 64); err == nil && n <= 0 {
+		return "max"
+	}
+	return limit
+}
+
+func (s *BlkioSubsystem) Set(path string, res *ResourceConfig) error {
+	throttles := []struct {
+		key     string
+		devices []ThrottleDevice
+	}{
+		{"blkio.throttle.read_bps_device", res.BlkioThrottleReadBps},
+		{"blkio.throttle.write_bps_device", res.BlkioThrottleWriteBps},
+		{"blkio.throttle.read_iops_device", res.BlkioThrottleReadIops},
+		{"blkio.throttle.write_iops_device", res.BlkioThrottleWriteIops},
+	}
+	// Only one device can be written at a time.
+	for _, throttle := range throttles {
+		for _, device := range throttle.devices {
+			if err := s.set(path, throttle.key, fmt.Sprintf("%d:%d %d", device.Major, device.Minor, device.Rate)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *HugetlbSubsystem) Set(path string, res *ResourceConfig) error {
+	for _, limit := range res.HugetlbLimits {
+		if err := s.set(path, fmt.Sprintf("hugetlb.%s.limit_in_bytes", limit.PageSize), strconv.FormatUint(limit.Limit, 10)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// The freezer state is not a resource limitation.
+func (s *FreezerSubsystem) Set(path string, res *ResourceConfig) error {
+	return nil
+}
+
+// Freeze or thaw all the tasks in the cgroup, and wait until the state is
+// confirmed by the kernel.
+func (s *FreezerSubsystem) Freeze(path string, frozen bool) error {
+	cgroupPath, err := s.getCgroupPath(path, false)
+	if err != nil {
+		return fmt.Errorf("getCgroupPath() of subsystem %s error %v", s.Name(), err)
+	}
+
+	state := FREEZER_STATE_THAWED
+	if frozen {
+		state = FREEZER_STATE_FROZEN
+	}
+	filePath := filepath.Join(cgroupPath, "freezer.state")
+	deadline := time.Now().Add(FREEZE_TIMEOUT)
+	for {
+		// Freezing may stay in FREEZING if a task is being forked, so the
+		// state is written again until it is reached.
+		if err := ioutil.WriteFile(filePath, []byte(state), 0644); err != nil {
+			return fmt.Errorf("WriteFile() %s error %v", filePath, err)
+		}
+		contentBytes, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("ReadFile() %s error %v", filePath, err)
+		}
+		if strings.TrimSpace(string(contentBytes)) == state {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Cgroup %s is not %s within %v", path, state, FREEZE_TIMEOUT)
+		}
+		time.Sleep(FREEZE_POLL_INTERVAL)
+	}
+}
+
+// Read freezer.state, which is one of THAWED, FREEZING and FROZEN.
+func (s *FreezerSubsystem) FreezerState(path string) (string, error) {
+	cgroupPath, err := s.getCgroupPath(path, false)
+	if err != nil {
+		return "", fmt.Errorf("getCgroupPath() of subsystem %s error %v", s.Name(), err)
+	}
+
+	filePath := filepath.Join(cgroupPath, "freezer.state")
+	contentBytes, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("ReadFile() %s error %v", filePath, err)
+	}
+
+	return strings.TrimSpace(string(contentBytes)), nil
 }
@@ -0,0 +1,402 @@
+package cgroups
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func newSubsystemsV2(fs CgroupFS) []Subsystem {
+	return []Subsystem{
+		&CpuSubsystemV2{SubsystemV2Base{SubsystemBase{name: "cpu", fs: fs}}},
+		&CpusetSubsystemV2{SubsystemV2Base{SubsystemBase{name: "cpuset", fs: fs}}},
+		&MemorySubsystemV2{SubsystemV2Base{SubsystemBase{name: "memory", fs: fs}}},
+		&PidsSubsystemV2{SubsystemV2Base{SubsystemBase{name: "pids", fs: fs}}},
+		&IoSubsystemV2{SubsystemV2Base{SubsystemBase{name: "io", fs: fs}}},
+		&HugetlbSubsystemV2{SubsystemV2Base{SubsystemBase{name: "hugetlb", fs: fs}}},
+		&FreezerSubsystemV2{SubsystemV2Base{SubsystemBase{name: "freezer", fs: fs}}},
+	}
+}
+
+// On cgroup v2 all the controllers share one hierarchy, and a controller has
+// to be enabled in cgroup.subtree_control of every ancestor before its
+// interface files appear in a cgroup.
+type SubsystemV2Base struct {
+	SubsystemBase
+}
+
+type CpuSubsystemV2 struct {
+	SubsystemV2Base
+}
+
+type CpusetSubsystemV2 struct {
+	SubsystemV2Base
+}
+
+type MemorySubsystemV2 struct {
+	SubsystemV2Base
+}
+
+type PidsSubsystemV2 struct {
+	SubsystemV2Base
+}
+
+// The blkio subsystem of v1 is named io on v2.
+type IoSubsystemV2 struct {
+	SubsystemV2Base
+}
+
+type HugetlbSubsystemV2 struct {
+	SubsystemV2Base
+}
+
+// The freezer is a core feature instead of a controller on v2, so it never
+// needs to be enabled.
+type FreezerSubsystemV2 struct {
+	SubsystemV2Base
+}
+
+// Enable this controller for path by writing every ancestor's
+// cgroup.subtree_control from the root.
+func (s *SubsystemV2Base) enableController(path string) error {
+	if _, err := s.getCgroupPath(path, true); err != nil {
+		return fmt.Errorf("getCgroupPath() of subsystem %s error %v", s.Name(), err)
+	}
+
+	parentPath := s.root()
+	for _, dir := range strings.Split(filepath.Clean(path), string(filepath.Separator)) {
+		if len(dir) == 0 {
+			continue
+		}
+		filePath := filepath.Join(parentPath, "cgroup.subtree_control")
+		if err := ioutil.WriteFile(filePath, []byte("+"+s.Name()), 0644); err != nil {
+			return fmt.Errorf("WriteFile() %s error %v", filePath, err)
+		}
+		parentPath = filepath.Join(parentPath, dir)
+	}
+
+	return nil
+}
+
+func (s *SubsystemV2Base) set(path, key, val string) error {
+	if len(val) == 0 {
+		return nil
+	}
+
+	if err := s.enableController(path); err != nil {
+		return fmt.Errorf("enableController() %s error %v", path, err)
+	}
+
+	return s.SubsystemBase.set(path, key, val)
+}
+
+// Return whether the controller is provided by the root cgroup.
+func (s *SubsystemV2Base) controllerAvailable() bool {
+	filePath := filepath.Join(s.root(), "cgroup.controllers")
+	contentBytes, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return false
+	}
+	for _, controller := range strings.Fields(string(contentBytes)) {
+		if controller == s.Name() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Enable the controller for the whole path before joining, so that the
+// parents are ready for the limitations set later by update.
+// Controllers not provided by the kernel are skipped, and Set fails instead if
+// any limitation of them is required.
+func (s *SubsystemV2Base) Apply(path string, pid int) error {
+	if s.controllerAvailable() {
+		if err := s.enableController(path); err != nil {
+			return fmt.Errorf("enableController() %s error %v", path, err)
+		}
+	}
+
+	return s.SubsystemBase.Apply(path, pid)
+}
+
+func (s *CpuSubsystemV2) Set(path string, res *ResourceConfig) error {
+	if len(res.CpuShares) != 0 {
+		shares, err := strconv.ParseUint(res.CpuShares, 10, 64)
+		if err != nil {
+			return fmt.Errorf("ParseUint() %s error %v", res.CpuShares, err)
+		}
+		if err := s.set(path, "cpu.weight", strconv.FormatUint(convertCpuSharesToWeight(shares), 10)); err != nil {
+			return err
+		}
+	}
+
+	// The format is '$MAX $PERIOD', and $MAX can be 'max' for no limitation.
+	if len(res.CpuQuota) != 0 || len(res.CpuPeriod) != 0 {
+		quota := res.CpuQuota
+		if len(quota) == 0 || quota == "-1" {
+			quota = "max"
+		}
+		val := quota
+		if len(res.CpuPeriod) != 0 {
+			val += " " + res.CpuPeriod
+		}
+		if err := s.set(path, "cpu.max", val); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Convert cpu.shares of range [2, 262144] on v1 to cpu.weight of range
+// [1, 10000] on v2, the same way as runc does.
+func convertCpuSharesToWeight(shares uint64) uint64 {
+	if shares == 0 {
+		return 0
+	}
+	if shares < 2 {
+		shares = 2
+	}
+	if shares > 262144 {
+		shares = 262144
+	}
+	return 1 + ((shares-2)*9999)/262142
+}
+
+func (s *CpusetSubsystemV2) Set(path string, res *ResourceConfig) error {
+	return s.set(path, "cpuset.cpus", res.Cpuset)
+}
+
+func (s *MemorySubsystemV2) Set(path string, res *ResourceConfig) error {
+	// Refuse before anything is written, so that the cgroup is unchanged.
+	swap, err := convertMemorySwap(res.MemorySwap, res.MemoryLimit)
+	if err != nil {
+		return fmt.Errorf("convertMemorySwap() %s error %v", res.MemorySwap, err)
+	}
+	if err := s.set(path, "memory.max", res.MemoryLimit); err != nil {
+		return err
+	}
+	if err := s.set(path, "memory.swap.max", swap); err != nil {
+		return err
+	}
+	return s.set(path, "memory.low", res.MemoryReservation)
+}
+
+// The memory plus swap limit on v1 is converted to the swap limit on v2, which
+// does not include the memory.
+func convertMemorySwap(memorySwap, memory string) (string, error) {
+	if len(memorySwap) == 0 {
+		return "", nil
+	}
+	if memorySwap == "-1" {
+		return "max", nil
+	}
+	if len(memory) == 0 {
+		return "", fmt.Errorf("Memory limit is required to limit swap")
+	}
+
+	memorySwapBytes, err := strconv.ParseInt(memorySwap, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("ParseInt() %s error %v", memorySwap, err)
+	}
+	memoryBytes, err := strconv.ParseInt(memory, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("ParseInt() %s error %v", memory, err)
+	}
+	if memorySwapBytes < memoryBytes {
+		return "", fmt.Errorf("Memory plus swap limit %d is less than memory limit %d", memorySwapBytes, memoryBytes)
+	}
+
+	return strconv.FormatInt(memorySwapBytes-memoryBytes, 10), nil
+}
+
+// Watch memory.events with inotify, and notify when the oom_kill counter
+// increases.
+func (s *MemorySubsystemV2) NotifyOOM(path string, done <-chan struct{}) (<-chan struct{}, error) {
+	cgroupPath, err := s.getCgroupPath(path, false)
+	if err != nil {
+		return nil, fmt.Errorf("getCgroupPath() of subsystem %s error %v", s.Name(), err)
+	}
+
+	lastCount, err := s.OOMKillCount(path)
+	if err != nil {
+		return nil, fmt.Errorf("OOMKillCount() %s error %v", path, err)
+	}
+
+	// Non-blocking so that closing the file interrupts the reading.
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("InotifyInit1() error %v", err)
+	}
+	inotifyFile := os.NewFile(uintptr(fd), "inotify")
+	eventsFilePath := filepath.Join(cgroupPath, "memory.events")
+	if _, err := syscall.InotifyAddWatch(fd, eventsFilePath, syscall.IN_MODIFY); err != nil {
+		inotifyFile.Close()
+		return nil, fmt.Errorf("InotifyAddWatch() %s error %v", eventsFilePath, err)
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		<-done
+		inotifyFile.Close()
+	}()
+	go func() {
+		defer close(ch)
+		buf := make([]byte, syscall.SizeofInotifyEvent+syscall.NAME_MAX+1)
+		for {
+			if _, err := inotifyFile.Read(buf); err != nil {
+				return
+			}
+			count, err := s.OOMKillCount(path)
+			if err != nil {
+				// The cgroup is removed.
+				return
+			}
+			if count <= lastCount {
+				continue
+			}
+			lastCount = count
+			select {
+			case ch <- struct{}{}:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// Read the oom_kill counter in memory.events, which is the number of
+// processes in this cgroup killed by the OOM killer.
+func (s *MemorySubsystemV2) OOMKillCount(path string) (int, error) {
+	cgroupPath, err := s.getCgroupPath(path, false)
+	if err != nil {
+		return 0, fmt.Errorf("getCgroupPath() of subsystem %s error %v", s.Name(), err)
+	}
+
+	filePath := filepath.Join(cgroupPath, "memory.events")
+	contentBytes, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("ReadFile() %s error %v", filePath, err)
+	}
+
+	// The content is like:
+	// low 0
+	// high 0
+	// max 0
+	// oom 0
+	// oom_kill 0
+	for _, line := range strings.Split(string(contentBytes), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			count, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return 0, fmt.Errorf("Atoi() %s error %v", fields[1], err)
+			}
+			return count, nil
+		}
+	}
+
+	return 0, nil
+}
+
+func (s *PidsSubsystemV2) Set(path string, res *ResourceConfig) error {
+	return s.set(path, "pids.max", convertPidsLimit(res.PidsLimit))
+}
+
+func (s *IoSubsystemV2) Set(path string, res *ResourceConfig) error {
+	throttles := []struct {
+		key     string
+		devices []ThrottleDevice
+	}{
+		{"rbps", res.BlkioThrottleReadBps},
+		{"wbps", res.BlkioThrottleWriteBps},
+		{"riops", res.BlkioThrottleReadIops},
+		{"wiops", res.BlkioThrottleWriteIops},
+	}
+	// The format is '$MAJ:$MIN $KEY=$VAL', and the other keys of the device
+	// are kept.
+	for _, throttle := range throttles {
+		for _, device := range throttle.devices {
+			if err := s.set(path, "io.max", fmt.Sprintf("%d:%d %s=%d", device.Major, device.Minor, throttle.key, device.Rate)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *HugetlbSubsystemV2) Set(path string, res *ResourceConfig) error {
+	for _, limit := range res.HugetlbLimits {
+		if err := s.set(path, fmt.Sprintf("hugetlb.%s.max", limit.PageSize), strconv.FormatUint(limit.Limit, 10)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *FreezerSubsystemV2) Set(path string, res *ResourceConfig) error {
+	return nil
+}
+
+// Write cgroup.freeze and wait until cgroup.events reports the state.
+func (s *FreezerSubsystemV2) Freeze(path string, frozen bool) error {
+	cgroupPath, err := s.getCgroupPath(path, false)
+	if err != nil {
+		return fmt.Errorf("getCgroupPath() of subsystem %s error %v", s.Name(), err)
+	}
+
+	val := "0"
+	if frozen {
+		val = "1"
+	}
+	filePath := filepath.Join(cgroupPath, "cgroup.freeze")
+	if err := ioutil.WriteFile(filePath, []byte(val), 0644); err != nil {
+		return fmt.Errorf("WriteFile() %s error %v", filePath, err)
+	}
+
+	deadline := time.Now().Add(FREEZE_TIMEOUT)
+	for {
+		state, err := s.FreezerState(path)
+		if err != nil {
+			return fmt.Errorf("FreezerState() %s error %v", path, err)
+		}
+		if (state == FREEZER_STATE_FROZEN) == frozen {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Cgroup %s is not frozen=%v within %v", path, frozen, FREEZE_TIMEOUT)
+		}
+		time.Sleep(FREEZE_POLL_INTERVAL)
+	}
+}
+
+// Map the frozen field of cgroup.events to the freezer states of v1.
+func (s *FreezerSubsystemV2) FreezerState(path string) (string, error) {
+	cgroupPath, err := s.getCgroupPath(path, false)
+	if err != nil {
+		return "", fmt.Errorf("getCgroupPath() of subsystem %s error %v", s.Name(), err)
+	}
+
+	// The content is like:
+	// populated 1
+	// frozen 0
+	events, err := readKeyValueFile(filepath.Join(cgroupPath, "cgroup.events"))
+	if err != nil {
+		return "", err
+	}
+	if events["frozen"] == 1 {
+		return FREEZER_STATE_FROZEN, nil
+	}
+
+	return FREEZER_STATE_THAWED, nil
+}
@@ -0,0 +1,96 @@
+package cgroups
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Find the root mount point of the cgroup subsystem.
+func FindCgroupMountPoint(subsystem string) string {
+	// This file contains information about mount points in the process's mount
+	// namespace. It supplies various information.
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		log.Errorf("Open() /proc/self/mountinfo error %v", err)
+		return ""
+	}
+	defer f.Close()
+
+	// Baseic format is:
+	// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+	// (1)(2)(3)   (4)   (5)      (6)      (7)   (8) (9)   (10)         (11)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		text := scanner.Text()
+		fields := strings.Split(text, " ")
+		for _, opt := range strings.Split(fields[len(fields)-1], ",") {
+			if opt == subsystem {
+				// Mount point: the pathname of the mount point relative to the
+				// process's root directory.
+				return fields[4]
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Errorf("Parse /proc/self/mountinfo error %v", err)
+	}
+
+	return ""
+}
+
+// Find the mount point of the cgroup v2 unified hierarchy.
+func FindCgroup2MountPoint() string {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		log.Errorf("Open() /proc/self/mountinfo error %v", err)
+		return ""
+	}
+	defer f.Close()
+
+	// The filesystem type is the field after the separator '-'.
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), " ")
+		for i, field := range fields {
+			if field == "-" && i+1 < len(fields) && fields[i+1] == "cgroup2" {
+				return fields[4]
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Errorf("Parse /proc/self/mountinfo error %v", err)
+	}
+
+	return ""
+}
+
+// Return the path of the cgroup in the hierarchy of the subsystem on the host.
+func GetCgroupPath(subsystem, cgroupPath string, autoCreate bool) (string, error) {
+	return getCgroupPath(hostFS.Root(subsystem), subsystem, cgroupPath, autoCreate)
+}
+
+func getCgroupPath(cgroupRoot, subsystem, cgroupPath string, autoCreate bool) (string, error) {
+	if len(cgroupRoot) == 0 {
+		return "", fmt.Errorf("Cannot find the mount point of cgroup subsystem %s", subsystem)
+	}
+	cgroupDirPath := filepath.Join(cgroupRoot, cgroupPath)
+	if _, err := os.Stat(cgroupDirPath); err != nil {
+		if os.IsNotExist(err) && autoCreate {
+			// The parent cgroups may not exist either.
+			if err := os.MkdirAll(cgroupDirPath, 0755); err != nil {
+				return "", fmt.Errorf("MkdirAll() %s error %v", cgroupDirPath, err)
+			}
+		} else {
+			return "", fmt.Errorf("Stat() %s error %v", cgroupDirPath, err)
+		}
+	}
+
+	return cgroupDirPath, nil
+}
@@ -0,0 +1,46 @@
+package cgroups
+
+import (
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	CGROUP_V1 = 1
+	CGROUP_V2 = 2
+
+	CGROUP_ROOT_PATH = "/sys/fs/cgroup"
+	// From linux/magic.h.
+	CGROUP2_SUPER_MAGIC = 0x63677270
+)
+
+// The hierarchies of the cgroup version detected at runtime.
+var hostFS CgroupFS
+
+func init() {
+	hostFS = &hostCgroupFS{
+		version: DetectCgroupVersion(),
+	}
+}
+
+// Only a cgroup2 filesystem mounted at CGROUP_ROOT_PATH means the unified
+// hierarchy. In the hybrid layout, cgroup2 is mounted elsewhere without any
+// controller, and the v1 hierarchies are used.
+func DetectCgroupVersion() int {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(CGROUP_ROOT_PATH, &stat); err != nil {
+		log.Warnf("Statfs() %s error %v, assume cgroup v1", CGROUP_ROOT_PATH, err)
+		return CGROUP_V1
+	}
+	if stat.Type == CGROUP2_SUPER_MAGIC {
+		return CGROUP_V2
+	}
+
+	return CGROUP_V1
+}
+
+// Return the cgroup version detected at runtime.
+func CgroupVersion() int {
+	return hostFS.Version()
+}
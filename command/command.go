@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/chengzeyi/dicker/container"
 	log "github.com/sirupsen/logrus"
@@ -13,6 +14,20 @@ import (
 const COMMAND_HELP = "help"
 const COMMAND_RUN = "run"
 const COMMAND_INIT = "init"
+const COMMAND_PS = "ps"
+const COMMAND_STOP = "stop"
+const COMMAND_RM = "rm"
+const COMMAND_LOGS = "logs"
+const COMMAND_LOGGER = "logger"
+const COMMAND_EXEC = "exec"
+const COMMAND_SHIM = "shim"
+const COMMAND_INSPECT = "inspect"
+const COMMAND_UPDATE = "update"
+const COMMAND_STATS = "stats"
+const COMMAND_PAUSE = "pause"
+const COMMAND_UNPAUSE = "unpause"
+const COMMAND_KILL = "kill"
+const COMMAND_VOLUME = "volume"
 
 type ICommand interface {
 	Execute(args []string) error
@@ -27,6 +42,20 @@ func init() {
 	commandMap[COMMAND_HELP] = &helpCmd
 	commandMap[COMMAND_RUN] = &runCmd
 	commandMap[COMMAND_INIT] = &initCmd
+	commandMap[COMMAND_PS] = &psCmd
+	commandMap[COMMAND_STOP] = &stopCmd
+	commandMap[COMMAND_RM] = &rmCmd
+	commandMap[COMMAND_LOGS] = &logsCmd
+	commandMap[COMMAND_LOGGER] = &loggerCmd
+	commandMap[COMMAND_EXEC] = &execCmd
+	commandMap[COMMAND_SHIM] = &shimCmd
+	commandMap[COMMAND_INSPECT] = &inspectCmd
+	commandMap[COMMAND_UPDATE] = &updateCmd
+	commandMap[COMMAND_STATS] = &statsCmd
+	commandMap[COMMAND_PAUSE] = &pauseCmd
+	commandMap[COMMAND_UNPAUSE] = &unpauseCmd
+	commandMap[COMMAND_KILL] = &killCmd
+	commandMap[COMMAND_VOLUME] = &volumeCmd
 }
 
 func GetCommand(cmdName string) ICommand {
@@ -111,11 +140,36 @@ var runCmd = Command{
 	usage:   "Create a container with namespace and cgroups limit, [OPTION]... <IMAGE> <COMMAND> [ARG]...",
 	flagSet: runFlagSet,
 	flags: map[string]interface{}{
-		"tty":            runFlagSet.Bool("tty", false, "enable tty"),
-		"container-name": runFlagSet.String("container-name", "", "set container name"),
-		"volume-mapping": runFlagSet.String("volume-mapping", "", "':' delimited mapping to mount a host volume to a container volume"),
-		"port-mappings":  runFlagSet.String("port-mappings", "", "':' delimited mappings separated by ',' to forward a host port to a container port"),
-		"envs":           runFlagSet.String("environments", "", "':' delimited environment variables"),
+		"tty":                       runFlagSet.Bool("tty", false, "enable tty"),
+		"container-name":            runFlagSet.String("container-name", "", "set container name"),
+		"tmpfs":                     newStringSliceFlag(runFlagSet, "tmpfs", "mount a tmpfs like /path[:size=64m][,mode=1777], can be repeated"),
+		"volumes":                   newStringSliceFlag(runFlagSet, "v", "bind a host path or a named volume like /host:/container or name:/container[:ro|rw][,rprivate|rshared|rslave], can be repeated"),
+		"port-mappings":             runFlagSet.String("port-mappings", "", "':' delimited mappings separated by ',' to forward a host port to a container port"),
+		"envs":                      newStringSliceFlag(runFlagSet, "e", "set an environment variable of the form KEY=VALUE, or inherit KEY from the host, can be repeated"),
+		"env-file":                  newStringSliceFlag(runFlagSet, "env-file", "read environment variables from a file in the dotenv syntax, can be repeated"),
+		"workdir":                   runFlagSet.String("workdir", "", "working directory of the command in the container"),
+		"hostname":                  runFlagSet.String("hostname", "", "container hostname, the container id by default"),
+		"user":                      runFlagSet.String("user", "", "user of the command like user[:group], names or ids in the image"),
+		"ulimit":                    newStringSliceFlag(runFlagSet, "ulimit", "resource limit like nofile=1024:2048, can be repeated"),
+		"labels":                    runFlagSet.String("labels", "", "'=' delimited labels separated by ','"),
+		"memory":                    runFlagSet.String("memory", "", "memory limit like 512m, units are b, k, m, g and t"),
+		"cpu-shares":                runFlagSet.String("cpu-shares", "", "relative CPU weight"),
+		"cpuset-cpus":               runFlagSet.String("cpuset-cpus", "", "CPUs allowed to use, like 0-2,4"),
+		"cpus":                      runFlagSet.String("cpus", "", "number of CPUs, like 1.5"),
+		"cpus-exclusive":            runFlagSet.String("cpus-exclusive", "", "number of CPUs exclusively allocated to the container"),
+		"cpu-period":                runFlagSet.String("cpu-period", "", "CFS period in microseconds"),
+		"cpu-quota":                 runFlagSet.String("cpu-quota", "", "CFS quota in microseconds per period, -1 for unlimited"),
+		"memory-swap":               runFlagSet.String("memory-swap", "", "memory plus swap limit like 1g, -1 for unlimited"),
+		"memory-reservation":        runFlagSet.String("memory-reservation", "", "memory soft limit like 256m"),
+		"pids-limit":                runFlagSet.String("pids-limit", "", "maximum number of processes, -1 for unlimited"),
+		"device-read-bps":           newStringSliceFlag(runFlagSet, "device-read-bps", "read rate of a device like /dev/sda:1mb, can be repeated"),
+		"device-write-bps":          newStringSliceFlag(runFlagSet, "device-write-bps", "write rate of a device like /dev/sda:1mb, can be repeated"),
+		"device-read-iops":          newStringSliceFlag(runFlagSet, "device-read-iops", "read IO rate of a device like /dev/sda:1000, can be repeated"),
+		"device-write-iops":         newStringSliceFlag(runFlagSet, "device-write-iops", "write IO rate of a device like /dev/sda:1000, can be repeated"),
+		"hugetlb-limit":             newStringSliceFlag(runFlagSet, "hugetlb-limit", "huge page limit like 2MB:1g, can be repeated"),
+		"cgroup-parent":             runFlagSet.String("cgroup-parent", DEFAULT_CGROUP_PARENT, "parent cgroup path shared with other containers"),
+		"memory-pressure-threshold": runFlagSet.String("memory-pressure-threshold", "", "emit an event when the percentage of time stalled on memory in 10 seconds exceeds it, cgroup v2 only"),
+		"restart":                   runFlagSet.String("restart", "no", "restart policy when the container exits, one of no, on-failure[:N], always and unless-stopped"),
 	},
 	action: func(argKV map[string]interface{}, tail []string) error {
 		if len(tail) == 0 {
@@ -126,13 +180,38 @@ var runCmd = Command{
 		}
 		imageName := tail[0]
 		cmdArr := tail[1:]
-		log.Info("image name %s, command array %v", imageName, cmdArr)
+		log.Infof("image name %s, command array %v", imageName, cmdArr)
 		runOption := &RunOption{
-			Tty:           argKV["tty"].(bool),
-			ContainerName: argKV["container-name"].(string),
-			VolumeMapping: argKV["volume-mapping"].(string),
-			PortMappings:  strings.Split(argKV["port-mappings"].(string), ","),
-			Envs:          strings.Split(argKV["envs"].(string), ":"),
+			Tty:                     *argKV["tty"].(*bool),
+			ContainerName:           *argKV["container-name"].(*string),
+			Volumes:                 *argKV["volumes"].(*[]string),
+			Tmpfs:                   *argKV["tmpfs"].(*[]string),
+			PortMappings:            strings.Split(*argKV["port-mappings"].(*string), ","),
+			Envs:                    *argKV["envs"].(*[]string),
+			EnvFiles:                *argKV["env-file"].(*[]string),
+			WorkDir:                 *argKV["workdir"].(*string),
+			Hostname:                *argKV["hostname"].(*string),
+			User:                    *argKV["user"].(*string),
+			Ulimits:                 *argKV["ulimit"].(*[]string),
+			Labels:                  strings.Split(*argKV["labels"].(*string), ","),
+			RestartPolicy:           *argKV["restart"].(*string),
+			Memory:                  *argKV["memory"].(*string),
+			CpuShares:               *argKV["cpu-shares"].(*string),
+			CpusetCpus:              *argKV["cpuset-cpus"].(*string),
+			Cpus:                    *argKV["cpus"].(*string),
+			CpusExclusive:           *argKV["cpus-exclusive"].(*string),
+			CpuPeriod:               *argKV["cpu-period"].(*string),
+			CpuQuota:                *argKV["cpu-quota"].(*string),
+			MemorySwap:              *argKV["memory-swap"].(*string),
+			MemoryReservation:       *argKV["memory-reservation"].(*string),
+			PidsLimit:               *argKV["pids-limit"].(*string),
+			DeviceReadBps:           *argKV["device-read-bps"].(*[]string),
+			DeviceWriteBps:          *argKV["device-write-bps"].(*[]string),
+			DeviceReadIops:          *argKV["device-read-iops"].(*[]string),
+			DeviceWriteIops:         *argKV["device-write-iops"].(*[]string),
+			HugetlbLimits:           *argKV["hugetlb-limit"].(*[]string),
+			CgroupParent:            *argKV["cgroup-parent"].(*string),
+			MemoryPressureThreshold: *argKV["memory-pressure-threshold"].(*string),
 		}
 		if err := Run(runOption, imageName, cmdArr); err != nil {
 			return fmt.Errorf("Run() image %s and command array %v error %v", imageName, cmdArr, err)
@@ -159,3 +238,444 @@ var initCmd = Command{
 		return nil
 	},
 }
+
+var psFlagSet = flag.NewFlagSet(COMMAND_PS, flag.ContinueOnError)
+var psCmd = Command{
+	usage:   "List containers, [OPTION]...",
+	flagSet: psFlagSet,
+	flags: map[string]interface{}{
+		"all":     psFlagSet.Bool("all", false, "show all containers instead of only running ones"),
+		"quiet":   psFlagSet.Bool("quiet", false, "only show container ids"),
+		"filters": psFlagSet.String("filters", "", "'=' delimited filters separated by ',', keys are name, status and label"),
+	},
+	action: func(argKV map[string]interface{}, tail []string) error {
+		if len(tail) > 0 {
+			return fmt.Errorf("Unexpected arguments %v", tail)
+		}
+		psOption := &PsOption{
+			All:     *argKV["all"].(*bool),
+			Quiet:   *argKV["quiet"].(*bool),
+			Filters: strings.Split(*argKV["filters"].(*string), ","),
+		}
+		if err := Ps(psOption); err != nil {
+			return fmt.Errorf("Ps() error %v", err)
+		}
+
+		return nil
+	},
+}
+
+var stopFlagSet = flag.NewFlagSet(COMMAND_STOP, flag.ContinueOnError)
+var stopCmd = Command{
+	usage:   "Stop running containers, [OPTION]... <CONTAINER_NAME>...",
+	flagSet: stopFlagSet,
+	flags: map[string]interface{}{
+		"time":   stopFlagSet.Int("time", 10, "seconds to wait for the container to exit before killing it"),
+		"signal": stopFlagSet.String("signal", "SIGTERM", "signal to send to the container"),
+	},
+	action: func(argKV map[string]interface{}, tail []string) error {
+		if len(tail) == 0 {
+			return fmt.Errorf("Missing container name")
+		}
+		stopOption := &StopOption{
+			Timeout: time.Duration(*argKV["time"].(*int)) * time.Second,
+			Signal:  *argKV["signal"].(*string),
+		}
+		if err := Stop(stopOption, tail); err != nil {
+			return fmt.Errorf("Stop() containers %v error %v", tail, err)
+		}
+
+		return nil
+	},
+}
+
+var rmFlagSet = flag.NewFlagSet(COMMAND_RM, flag.ContinueOnError)
+var rmCmd = Command{
+	usage:   "Remove containers and release their resources, [OPTION]... <CONTAINER_NAME>...",
+	flagSet: rmFlagSet,
+	flags: map[string]interface{}{
+		"force":   rmFlagSet.Bool("force", false, "kill and remove running containers"),
+		"volumes": rmFlagSet.Bool("volumes", false, "also delete the host directories created for the container volumes, never existing host paths"),
+	},
+	action: func(argKV map[string]interface{}, tail []string) error {
+		if len(tail) == 0 {
+			return fmt.Errorf("Missing container name")
+		}
+		rmOption := &RmOption{
+			Force:   *argKV["force"].(*bool),
+			Volumes: *argKV["volumes"].(*bool),
+		}
+		if err := Rm(rmOption, tail); err != nil {
+			return fmt.Errorf("Rm() containers %v error %v", tail, err)
+		}
+
+		return nil
+	},
+}
+
+var logsFlagSet = flag.NewFlagSet(COMMAND_LOGS, flag.ContinueOnError)
+var logsCmd = Command{
+	usage:   "Print the stdout and stderr of a container, [OPTION]... <CONTAINER_NAME>",
+	flagSet: logsFlagSet,
+	flags: map[string]interface{}{
+		"follow":     logsFlagSet.Bool("follow", false, "keep printing new log until the container exits"),
+		"tail":       logsFlagSet.Int("tail", -1, "number of lines to show from the end of the log, negative for all"),
+		"since":      logsFlagSet.String("since", "", "show log since a RFC3339 time, a Unix timestamp or a relative duration like 10m"),
+		"timestamps": logsFlagSet.Bool("timestamps", false, "show timestamps"),
+	},
+	action: func(argKV map[string]interface{}, tail []string) error {
+		if len(tail) != 1 {
+			return fmt.Errorf("Expect exactly one container name")
+		}
+		containerName := tail[0]
+		logsOption := &LogsOption{
+			Follow:     *argKV["follow"].(*bool),
+			Tail:       *argKV["tail"].(*int),
+			Since:      *argKV["since"].(*string),
+			Timestamps: *argKV["timestamps"].(*bool),
+		}
+		if err := Logs(logsOption, containerName); err != nil {
+			return fmt.Errorf("Logs() %s error %v", containerName, err)
+		}
+
+		return nil
+	},
+}
+
+var loggerFlagSet = flag.NewFlagSet(COMMAND_LOGGER, flag.ContinueOnError)
+var loggerCmd = Command{
+	usage:   "Copy container stdout and stderr from pipes to the log file, <CONTAINER_NAME>. Do not call it outside",
+	flagSet: loggerFlagSet,
+	flags:   map[string]interface{}{},
+	action: func(argKV map[string]interface{}, tail []string) error {
+		if len(tail) != 1 {
+			return fmt.Errorf("Expect exactly one container name")
+		}
+
+		if err := container.RunContainerLogger(tail[0]); err != nil {
+			return fmt.Errorf("RunContainerLogger() %s error %v", tail[0], err)
+		}
+
+		return nil
+	},
+}
+
+var execFlagSet = flag.NewFlagSet(COMMAND_EXEC, flag.ContinueOnError)
+var execCmd = Command{
+	usage:   "Run a command in a running container, [OPTION]... <CONTAINER_NAME> <COMMAND> [ARG]...",
+	flagSet: execFlagSet,
+	flags: map[string]interface{}{
+		"tty":     execFlagSet.Bool("t", false, "attach stdin to the command"),
+		"envs":    newStringSliceFlag(execFlagSet, "e", "set an environment variable of the form KEY=VALUE, can be repeated"),
+		"workdir": execFlagSet.String("w", "/", "working directory inside the container"),
+	},
+	action: func(argKV map[string]interface{}, tail []string) error {
+		if len(tail) == 0 {
+			return fmt.Errorf("Missing container name")
+		}
+		if len(tail) == 1 {
+			return fmt.Errorf("Missing command")
+		}
+		containerName := tail[0]
+		cmdArr := tail[1:]
+		execOption := &ExecOption{
+			Tty:     *argKV["tty"].(*bool),
+			Envs:    *argKV["envs"].(*[]string),
+			WorkDir: *argKV["workdir"].(*string),
+		}
+		for _, env := range execOption.Envs {
+			if !strings.Contains(env, "=") {
+				return fmt.Errorf("Invalid environment variable %s", env)
+			}
+		}
+		exitCode, err := Exec(execOption, containerName, cmdArr)
+		if err != nil {
+			return fmt.Errorf("Exec() %v in %s error %v", cmdArr, containerName, err)
+		}
+		// Propagate the exit code of the command.
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+
+		return nil
+	},
+}
+
+var shimFlagSet = flag.NewFlagSet(COMMAND_SHIM, flag.ContinueOnError)
+var shimCmd = Command{
+	usage:   "Start and supervise a detached container, <CONTAINER_NAME>. Do not call it outside",
+	flagSet: shimFlagSet,
+	flags:   map[string]interface{}{},
+	action: func(argKV map[string]interface{}, tail []string) error {
+		if len(tail) != 1 {
+			return fmt.Errorf("Expect exactly one container name")
+		}
+
+		if err := RunShim(tail[0]); err != nil {
+			return fmt.Errorf("RunShim() %s error %v", tail[0], err)
+		}
+
+		return nil
+	},
+}
+
+var inspectFlagSet = flag.NewFlagSet(COMMAND_INSPECT, flag.ContinueOnError)
+var inspectCmd = Command{
+	usage:   "Print detailed information of containers in JSON, <CONTAINER_NAME>...",
+	flagSet: inspectFlagSet,
+	flags:   map[string]interface{}{},
+	action: func(argKV map[string]interface{}, tail []string) error {
+		if len(tail) == 0 {
+			return fmt.Errorf("Missing container name")
+		}
+
+		if err := Inspect(tail); err != nil {
+			return fmt.Errorf("Inspect() containers %v error %v", tail, err)
+		}
+
+		return nil
+	},
+}
+
+var updateFlagSet = flag.NewFlagSet(COMMAND_UPDATE, flag.ContinueOnError)
+var updateCmd = Command{
+	usage:   "Update resource limitations of containers or a cgroup parent, [OPTION]... [CONTAINER_NAME]...",
+	flagSet: updateFlagSet,
+	flags: map[string]interface{}{
+		"memory":        updateFlagSet.String("memory", "", "memory limit like 512m, units are b, k, m, g and t"),
+		"cpu-shares":    updateFlagSet.String("cpu-shares", "", "relative CPU weight"),
+		"cpus":          updateFlagSet.String("cpus", "", "number of CPUs, like 1.5"),
+		"cpuset-cpus":   updateFlagSet.String("cpuset-cpus", "", "CPUs allowed to use, like 0-2,4"),
+		"pids-limit":    updateFlagSet.String("pids-limit", "", "maximum number of processes, -1 for unlimited"),
+		"cgroup-parent": updateFlagSet.String("cgroup-parent", "", "update the aggregate limitations of this cgroup parent instead of containers"),
+	},
+	action: func(argKV map[string]interface{}, tail []string) error {
+		if len(tail) == 0 && len(*argKV["cgroup-parent"].(*string)) == 0 {
+			return fmt.Errorf("Missing container name")
+		}
+		updateOption := &UpdateOption{
+			Memory:       *argKV["memory"].(*string),
+			CpuShares:    *argKV["cpu-shares"].(*string),
+			Cpus:         *argKV["cpus"].(*string),
+			CpusetCpus:   *argKV["cpuset-cpus"].(*string),
+			PidsLimit:    *argKV["pids-limit"].(*string),
+			CgroupParent: *argKV["cgroup-parent"].(*string),
+		}
+		if err := Update(updateOption, tail); err != nil {
+			return fmt.Errorf("Update() containers %v error %v", tail, err)
+		}
+
+		return nil
+	},
+}
+
+var statsFlagSet = flag.NewFlagSet(COMMAND_STATS, flag.ContinueOnError)
+var statsCmd = Command{
+	usage:   "Show resource usage of containers, all running ones if none is given, [OPTION]... [CONTAINER_NAME]...",
+	flagSet: statsFlagSet,
+	flags: map[string]interface{}{
+		"no-stream": statsFlagSet.Bool("no-stream", false, "print the usage once instead of refreshing it"),
+		"format":    statsFlagSet.String("format", STATS_FORMAT_TABLE, "output format, table or json with one line per container for metrics collectors"),
+	},
+	action: func(argKV map[string]interface{}, tail []string) error {
+		statsOption := &StatsOption{
+			NoStream: *argKV["no-stream"].(*bool),
+			Format:   *argKV["format"].(*string),
+		}
+		if err := Stats(statsOption, tail); err != nil {
+			return fmt.Errorf("Stats() containers %v error %v", tail, err)
+		}
+
+		return nil
+	},
+}
+
+var pauseFlagSet = flag.NewFlagSet(COMMAND_PAUSE, flag.ContinueOnError)
+var pauseCmd = Command{
+	usage:   "Freeze all processes of containers, <CONTAINER_NAME>...",
+	flagSet: pauseFlagSet,
+	flags:   map[string]interface{}{},
+	action: func(argKV map[string]interface{}, tail []string) error {
+		if len(tail) == 0 {
+			return fmt.Errorf("Missing container name")
+		}
+
+		if err := Pause(tail); err != nil {
+			return fmt.Errorf("Pause() containers %v error %v", tail, err)
+		}
+
+		return nil
+	},
+}
+
+var unpauseFlagSet = flag.NewFlagSet(COMMAND_UNPAUSE, flag.ContinueOnError)
+var unpauseCmd = Command{
+	usage:   "Resume all processes of paused containers, <CONTAINER_NAME>...",
+	flagSet: unpauseFlagSet,
+	flags:   map[string]interface{}{},
+	action: func(argKV map[string]interface{}, tail []string) error {
+		if len(tail) == 0 {
+			return fmt.Errorf("Missing container name")
+		}
+
+		if err := Unpause(tail); err != nil {
+			return fmt.Errorf("Unpause() containers %v error %v", tail, err)
+		}
+
+		return nil
+	},
+}
+
+var killFlagSet = flag.NewFlagSet(COMMAND_KILL, flag.ContinueOnError)
+var killCmd = Command{
+	usage:   "Send a signal to every process of containers, [OPTION]... <CONTAINER_NAME>...",
+	flagSet: killFlagSet,
+	flags: map[string]interface{}{
+		"signal": killFlagSet.String("signal", "SIGKILL", "signal to send"),
+	},
+	action: func(argKV map[string]interface{}, tail []string) error {
+		if len(tail) == 0 {
+			return fmt.Errorf("Missing container name")
+		}
+		killOption := &KillOption{
+			Signal: *argKV["signal"].(*string),
+		}
+		if err := Kill(killOption, tail); err != nil {
+			return fmt.Errorf("Kill() containers %v error %v", tail, err)
+		}
+
+		return nil
+	},
+}
+
+const VOLUME_COMMAND_CREATE = "create"
+const VOLUME_COMMAND_LS = "ls"
+const VOLUME_COMMAND_INSPECT = "inspect"
+const VOLUME_COMMAND_RM = "rm"
+const VOLUME_COMMAND_PRUNE = "prune"
+
+var volumeCommandMap = map[string]ICommand{}
+
+func init() {
+	volumeCommandMap[VOLUME_COMMAND_CREATE] = &volumeCreateCmd
+	volumeCommandMap[VOLUME_COMMAND_LS] = &volumeLsCmd
+	volumeCommandMap[VOLUME_COMMAND_INSPECT] = &volumeInspectCmd
+	volumeCommandMap[VOLUME_COMMAND_RM] = &volumeRmCmd
+	volumeCommandMap[VOLUME_COMMAND_PRUNE] = &volumePruneCmd
+}
+
+var volumeFlagSet = flag.NewFlagSet(COMMAND_VOLUME, flag.ContinueOnError)
+var volumeCmd = Command{
+	usage:   "Manage named volumes, <create|ls|inspect|rm|prune> [OPTION]... [ARG]...",
+	flagSet: volumeFlagSet,
+	flags:   map[string]interface{}{},
+	action: func(argKV map[string]interface{}, tail []string) error {
+		if len(tail) == 0 {
+			for _, v := range volumeCommandMap {
+				v.Help()
+			}
+			return fmt.Errorf("Missing volume command")
+		}
+		volumeCommand := volumeCommandMap[tail[0]]
+		if volumeCommand == nil {
+			return fmt.Errorf("Unknown volume command %s", tail[0])
+		}
+
+		return volumeCommand.Execute(tail[1:])
+	},
+}
+
+var volumeCreateFlagSet = flag.NewFlagSet(COMMAND_VOLUME+" "+VOLUME_COMMAND_CREATE, flag.ContinueOnError)
+var volumeCreateCmd = Command{
+	usage:   "Create a named volume, [OPTION]... <VOLUME_NAME>",
+	flagSet: volumeCreateFlagSet,
+	flags: map[string]interface{}{
+		"driver": volumeCreateFlagSet.String("driver", container.VOLUME_DRIVER_LOCAL, "volume driver, local, tmpfs or loop"),
+		"opt":    newStringSliceFlag(volumeCreateFlagSet, "opt", "driver option like size=64m or mode=1777, can be repeated"),
+		"labels": volumeCreateFlagSet.String("labels", "", "'=' delimited labels separated by ','"),
+	},
+	action: func(argKV map[string]interface{}, tail []string) error {
+		if len(tail) != 1 {
+			return fmt.Errorf("Exactly one volume name is required")
+		}
+		volumeCreateOption := &VolumeCreateOption{
+			Driver:  *argKV["driver"].(*string),
+			Options: *argKV["opt"].(*[]string),
+			Labels:  strings.Split(*argKV["labels"].(*string), ","),
+		}
+		if err := VolumeCreate(volumeCreateOption, tail[0]); err != nil {
+			return fmt.Errorf("VolumeCreate() %s error %v", tail[0], err)
+		}
+
+		return nil
+	},
+}
+
+var volumeLsFlagSet = flag.NewFlagSet(COMMAND_VOLUME+" "+VOLUME_COMMAND_LS, flag.ContinueOnError)
+var volumeLsCmd = Command{
+	usage:   "List named volumes, [OPTION]...",
+	flagSet: volumeLsFlagSet,
+	flags: map[string]interface{}{
+		"quiet": volumeLsFlagSet.Bool("quiet", false, "only display volume names"),
+	},
+	action: func(argKV map[string]interface{}, tail []string) error {
+		volumeLsOption := &VolumeLsOption{
+			Quiet: *argKV["quiet"].(*bool),
+		}
+		if err := VolumeLs(volumeLsOption); err != nil {
+			return fmt.Errorf("VolumeLs() error %v", err)
+		}
+
+		return nil
+	},
+}
+
+var volumeInspectFlagSet = flag.NewFlagSet(COMMAND_VOLUME+" "+VOLUME_COMMAND_INSPECT, flag.ContinueOnError)
+var volumeInspectCmd = Command{
+	usage:   "Show the metadata of named volumes, <VOLUME_NAME>...",
+	flagSet: volumeInspectFlagSet,
+	flags:   map[string]interface{}{},
+	action: func(argKV map[string]interface{}, tail []string) error {
+		if len(tail) == 0 {
+			return fmt.Errorf("Missing volume name")
+		}
+
+		if err := VolumeInspect(tail); err != nil {
+			return fmt.Errorf("VolumeInspect() volumes %v error %v", tail, err)
+		}
+
+		return nil
+	},
+}
+
+var volumeRmFlagSet = flag.NewFlagSet(COMMAND_VOLUME+" "+VOLUME_COMMAND_RM, flag.ContinueOnError)
+var volumeRmCmd = Command{
+	usage:   "Remove named volumes not used by any container, <VOLUME_NAME>...",
+	flagSet: volumeRmFlagSet,
+	flags:   map[string]interface{}{},
+	action: func(argKV map[string]interface{}, tail []string) error {
+		if len(tail) == 0 {
+			return fmt.Errorf("Missing volume name")
+		}
+
+		if err := VolumeRm(tail); err != nil {
+			return fmt.Errorf("VolumeRm() volumes %v error %v", tail, err)
+		}
+
+		return nil
+	},
+}
+
+var volumePruneFlagSet = flag.NewFlagSet(COMMAND_VOLUME+" "+VOLUME_COMMAND_PRUNE, flag.ContinueOnError)
+var volumePruneCmd = Command{
+	usage:   "Remove all named volumes not used by any container",
+	flagSet: volumePruneFlagSet,
+	flags:   map[string]interface{}{},
+	action: func(argKV map[string]interface{}, tail []string) error {
+		if err := VolumePrune(); err != nil {
+			return fmt.Errorf("VolumePrune() error %v", err)
+		}
+
+		return nil
+	},
+}
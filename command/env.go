@@ -0,0 +1,87 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chengzeyi/dicker/container"
+	"github.com/chengzeyi/dicker/util"
+)
+
+// Optional default environment variables of an image are kept next to the
+// image tarball, like IMAGE_DIR_PATH/busybox.env, in the dotenv syntax.
+const IMAGE_ENV_FILE_EXT = ".env"
+
+// Build the environment of a container from scratch, without anything of the
+// host unless asked for.
+// Later sources override earlier ones: PATH and HOSTNAME, the image env file,
+// the env files in order and then the variables in envs.
+// A variable of the form KEY is inherited from the host, and skipped if the
+// host does not have it.
+func buildContainerEnvs(imageName, hostname string, envFiles, envs []string) ([]string, error) {
+	merged := []string{
+		"PATH=" + container.DEFAULT_PATH_ENV,
+		"HOSTNAME=" + hostname,
+	}
+
+	imageEnvFilePath := filepath.Join(container.IMAGE_DIR_PATH, imageName+IMAGE_ENV_FILE_EXT)
+	imageEnvs, err := readEnvFile(imageEnvFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("readEnvFile() %s error %v", imageEnvFilePath, err)
+	}
+	merged = mergeEnvs(merged, imageEnvs)
+
+	for _, envFile := range envFiles {
+		fileEnvs, err := readEnvFile(envFile)
+		if err != nil {
+			return nil, fmt.Errorf("readEnvFile() %s error %v", envFile, err)
+		}
+		merged = mergeEnvs(merged, fileEnvs)
+	}
+
+	var optionEnvs []string
+	for _, env := range envs {
+		key := strings.SplitN(env, "=", 2)[0]
+		if len(key) == 0 {
+			return nil, fmt.Errorf("Invalid environment variable %s", env)
+		}
+		optionEnvs = append(optionEnvs, env)
+	}
+	merged = mergeEnvs(merged, inheritHostEnvs(optionEnvs))
+
+	return merged, nil
+}
+
+// The returned error satisfies os.IsNotExist if the file does not exist.
+func readEnvFile(filePath string) ([]string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	envs, err := util.ParseEnvFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("ParseEnvFile() %s error %v", filePath, err)
+	}
+
+	return inheritHostEnvs(envs), nil
+}
+
+// Replace every variable of the form KEY with its value on the host.
+func inheritHostEnvs(envs []string) []string {
+	var resolved []string
+	for _, env := range envs {
+		if strings.Contains(env, "=") {
+			resolved = append(resolved, env)
+			continue
+		}
+		if val, ok := os.LookupEnv(env); ok {
+			resolved = append(resolved, env+"="+val)
+		}
+	}
+
+	return resolved
+}
@@ -0,0 +1,48 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/chengzeyi/dicker/container"
+)
+
+func Test_buildContainerEnvs(t *testing.T) {
+	envFile, err := ioutil.TempFile("", "dicker_env_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(envFile.Name())
+	if _, err := envFile.WriteString("A=file\nB=file\nA=file2\nDICKER_TEST_HOST\n"); err != nil {
+		t.Fatal(err)
+	}
+	envFile.Close()
+	os.Setenv("DICKER_TEST_HOST", "host:1")
+	defer os.Unsetenv("DICKER_TEST_HOST")
+
+	got, err := buildContainerEnvs("dicker_no_such_image", "box", []string{envFile.Name()},
+		[]string{"B=option", "URL=http://a:b@c", "DICKER_TEST_HOST", "DICKER_TEST_UNSET", "URL=http://d"})
+	if err != nil {
+		t.Fatalf("buildContainerEnvs() error %v", err)
+	}
+	want := []string{
+		"PATH=" + container.DEFAULT_PATH_ENV,
+		"HOSTNAME=box",
+		"A=file2",
+		"B=option",
+		"DICKER_TEST_HOST=host:1",
+		"URL=http://d",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("buildContainerEnvs() = %q, want %q", got, want)
+	}
+
+	if _, err := buildContainerEnvs("dicker_no_such_image", "box", []string{"/dicker/no/such/file"}, nil); err == nil {
+		t.Errorf("buildContainerEnvs() of a missing env file succeeds")
+	}
+	if _, err := buildContainerEnvs("dicker_no_such_image", "box", nil, []string{"=1"}); err == nil {
+		t.Errorf("buildContainerEnvs() of an empty key succeeds")
+	}
+}
@@ -0,0 +1,166 @@
+package command
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/chengzeyi/dicker/cgroups"
+	"github.com/chengzeyi/dicker/container"
+	"github.com/chengzeyi/dicker/nsenter"
+	"github.com/chengzeyi/dicker/util"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type ExecOption struct {
+	Tty     bool
+	Envs    []string
+	WorkDir string
+}
+
+// Run a command in the namespaces and cgroups of a running container.
+// Return the exit code of the command.
+func Exec(option *ExecOption, containerName string, cmdArr []string) (int, error) {
+	containerInfo, err := container.LoadContainerInfo(containerName)
+	if err != nil {
+		return 0, fmt.Errorf("LoadContainerInfo() %s error %v", containerName, err)
+	}
+	containerInfo.RefreshStatus()
+	// The command would be frozen as soon as it joins the cgroups.
+	if containerInfo.Status == container.STATUS_PAUSED {
+		return 0, fmt.Errorf("Container %s is paused, unpause it first", containerName)
+	}
+	pid := containerInfo.Pid
+	if !container.IsProcessAlive(pid) {
+		return 0, fmt.Errorf("Container %s is not running", containerName)
+	}
+
+	selfCmd, err := os.Readlink("/proc/self/exe")
+	if err != nil {
+		return 0, fmt.Errorf("Readlink() /proc/self/exe error %v", err)
+	}
+
+	// The namespaces are entered by the C constructor in package nsenter
+	// before the Go runtime of the child starts.
+	execCmd := exec.Command(selfCmd, append([]string{COMMAND_EXEC}, cmdArr...)...)
+	execCmd.Env = append(mergeEnvs(util.GetEnvsByPid(strconv.Itoa(pid)), option.Envs),
+		fmt.Sprintf("%s=%d", nsenter.EXEC_PID_ENV, pid),
+		fmt.Sprintf("%s=%s", nsenter.EXEC_WORKDIR_ENV, option.WorkDir),
+	)
+	if option.Tty {
+		execCmd.Stdin = os.Stdin
+	}
+	execCmd.Stdout = os.Stdout
+	execCmd.Stderr = os.Stderr
+
+	// The child waits on this pipe until it is in the container cgroups.
+	rPipe, wPipe, err := os.Pipe()
+	if err != nil {
+		return 0, fmt.Errorf("Pipe() error %v", err)
+	}
+	execCmd.ExtraFiles = []*os.File{
+		rPipe,
+	}
+	if err := execCmd.Start(); err != nil {
+		rPipe.Close()
+		wPipe.Close()
+		return 0, fmt.Errorf("Start() exec process error %v", err)
+	}
+	rPipe.Close()
+
+	if err := joinCgroups(pid, execCmd.Process.Pid); err != nil {
+		wPipe.Close()
+		execCmd.Process.Kill()
+		execCmd.Wait()
+		return 0, fmt.Errorf("joinCgroups() of container pid %d error %v", pid, err)
+	}
+	wPipe.Close()
+
+	if err := execCmd.Wait(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode(), nil
+		}
+		return 0, fmt.Errorf("Wait() exec process error %v", err)
+	}
+
+	return 0, nil
+}
+
+// Append extraEnvs of the form KEY=VALUE to envs.
+// A variable in extraEnvs overrides the one with the same key in envs, and
+// the last one wins among those with the same key in extraEnvs.
+func mergeEnvs(envs, extraEnvs []string) []string {
+	last := map[string]int{}
+	for i, env := range extraEnvs {
+		last[strings.SplitN(env, "=", 2)[0]] = i
+	}
+
+	var merged []string
+	for _, env := range envs {
+		if _, overridden := last[strings.SplitN(env, "=", 2)[0]]; len(env) == 0 || overridden {
+			continue
+		}
+		merged = append(merged, env)
+	}
+	for i, env := range extraEnvs {
+		if last[strings.SplitN(env, "=", 2)[0]] == i {
+			merged = append(merged, env)
+		}
+	}
+
+	return merged
+}
+
+// Move pid to every cgroup hierarchy that containerPid is in.
+func joinCgroups(containerPid, pid int) error {
+	cgroupFilePath := filepath.Join("/proc", strconv.Itoa(containerPid), "cgroup")
+	f, err := os.Open(cgroupFilePath)
+	if err != nil {
+		return fmt.Errorf("Open() %s error %v", cgroupFilePath, err)
+	}
+	defer f.Close()
+
+	// Each line is hierarchy-ID:controller-list:cgroup-path, like
+	// 4:memory:/dicker/1234567890
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		var cgroupRoot string
+		// The cgroup v2 hierarchy has an empty controller list, like
+		// 0::/dicker/1234567890
+		if len(fields[1]) == 0 {
+			cgroupRoot = cgroups.FindCgroup2MountPoint()
+			if len(cgroupRoot) == 0 {
+				log.Warnf("Cannot find the mount point of cgroup v2")
+				continue
+			}
+		} else {
+			subsystem := strings.Split(fields[1], ",")[0]
+			cgroupRoot = cgroups.FindCgroupMountPoint(subsystem)
+			if len(cgroupRoot) == 0 {
+				log.Warnf("Cannot find the mount point of cgroup subsystem %s", subsystem)
+				continue
+			}
+		}
+
+		procsFilePath := filepath.Join(cgroupRoot, fields[2], "cgroup.procs")
+		if err := ioutil.WriteFile(procsFilePath, []byte(strconv.Itoa(pid)), 0644); err != nil {
+			return fmt.Errorf("WriteFile() %s error %v", procsFilePath, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Scan() %s error %v", cgroupFilePath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,15 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_mergeEnvs(t *testing.T) {
+	envs := []string{"PATH=/bin", "HOME=/root", ""}
+	extraEnvs := []string{"HOME=/home/dicker", "FOO=a=b"}
+	want := []string{"PATH=/bin", "HOME=/home/dicker", "FOO=a=b"}
+	if got := mergeEnvs(envs, extraEnvs); !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeEnvs() = %v, want %v", got, want)
+	}
+}
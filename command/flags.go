@@ -0,0 +1,26 @@
+package command
+
+import (
+	"flag"
+	"strings"
+)
+
+// A flag.Value collecting every occurrence of a repeatable flag.
+type stringSliceValue []string
+
+func (s *stringSliceValue) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceValue) Set(val string) error {
+	*s = append(*s, val)
+	return nil
+}
+
+// Define a repeatable string flag like flagSet.String does.
+// The returned slice contains the values in the order they appear.
+func newStringSliceFlag(flagSet *flag.FlagSet, name, usage string) *[]string {
+	var s []string
+	flagSet.Var((*stringSliceValue)(&s), name, usage)
+	return &s
+}
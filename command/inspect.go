@@ -0,0 +1,30 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/chengzeyi/dicker/container"
+)
+
+// Print the information of the containers as an indented JSON array.
+func Inspect(containerNames []string) error {
+	var containerInfos []*container.ContainerInfo
+	for _, containerName := range containerNames {
+		containerInfo, err := container.LoadContainerInfo(containerName)
+		if err != nil {
+			return fmt.Errorf("LoadContainerInfo() %s error %v", containerName, err)
+		}
+		containerInfo.RefreshStatus()
+		containerInfos = append(containerInfos, containerInfo)
+	}
+
+	jsonBytes, err := json.MarshalIndent(containerInfos, "", "    ")
+	if err != nil {
+		return fmt.Errorf("MarshalIndent() %v error %v", containerInfos, err)
+	}
+	fmt.Fprintln(os.Stdout, string(jsonBytes))
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/chengzeyi/dicker/container"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type KillOption struct {
+	Signal string
+}
+
+// Send a signal to every process of the containers one by one.
+// The returned error is the last occurred error.
+func Kill(option *KillOption, containerNames []string) error {
+	sig, err := parseSignal(option.Signal)
+	if err != nil {
+		return fmt.Errorf("parseSignal() %s error %v", option.Signal, err)
+	}
+
+	var retErr error
+	for _, containerName := range containerNames {
+		containerInfo, err := container.LoadContainerInfo(containerName)
+		if err != nil {
+			retErr = fmt.Errorf("LoadContainerInfo() %s error %v", containerName, err)
+			log.Error(retErr.Error())
+			continue
+		}
+		containerInfo.RefreshStatus()
+		if containerInfo.Status != container.STATUS_RUNNING && containerInfo.Status != container.STATUS_PAUSED {
+			retErr = fmt.Errorf("Container %s is %s, not running", containerName, containerInfo.Status)
+			log.Error(retErr.Error())
+			continue
+		}
+
+		if err := killContainerProcesses(containerInfo, sig); err != nil {
+			retErr = fmt.Errorf("killContainerProcesses() %s error %v", containerName, err)
+			log.Error(retErr.Error())
+			continue
+		}
+		// The cgroup is thawed for the signal to be handled.
+		// Reload the info, since the shim may have recorded the exit
+		// meanwhile.
+		if containerInfo.Status != container.STATUS_PAUSED {
+			continue
+		}
+		containerInfo, unlock, err := container.LoadContainerInfoLocked(containerName)
+		if err != nil {
+			retErr = fmt.Errorf("LoadContainerInfoLocked() %s error %v", containerName, err)
+			log.Error(retErr.Error())
+			continue
+		}
+		if containerInfo.Status == container.STATUS_PAUSED {
+			containerInfo.Status = container.STATUS_RUNNING
+			if err := containerInfo.Dump(); err != nil {
+				retErr = fmt.Errorf("Dump() %v error %v", containerInfo, err)
+				log.Error(retErr.Error())
+			}
+		}
+		unlock()
+	}
+
+	return retErr
+}
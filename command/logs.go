@@ -0,0 +1,153 @@
+package command
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/chengzeyi/dicker/container"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const LOGS_POLL_INTERVAL = 200 * time.Millisecond
+
+type LogsOption struct {
+	Follow     bool
+	Tail       int
+	Since      string
+	Timestamps bool
+}
+
+// Print the log of the container.
+// With Follow, keep printing new lines until the container exits.
+func Logs(option *LogsOption, containerName string) error {
+	since, err := parseSince(option.Since, time.Now())
+	if err != nil {
+		return fmt.Errorf("parseSince() %s error %v", option.Since, err)
+	}
+
+	logFilePath := filepath.Join(container.DEFAULT_INFO_DIR_PATH, containerName, container.CONTAINER_LOG_FILE_NAME)
+	logFile, err := os.Open(logFilePath)
+	if err != nil {
+		return fmt.Errorf("Open() %s error %v", logFilePath, err)
+	}
+	defer logFile.Close()
+
+	reader := bufio.NewReader(logFile)
+	// Lines already in the file are buffered to apply the tail option.
+	entries, pending, err := readLogEntries(reader, nil)
+	if err != nil {
+		return fmt.Errorf("readLogEntries() %s error %v", logFilePath, err)
+	}
+	entries = filterLogEntries(entries, since, option.Tail)
+	for _, entry := range entries {
+		printLogEntry(entry, option.Timestamps)
+	}
+
+	if !option.Follow {
+		return nil
+	}
+
+	for {
+		containerInfo, err := container.LoadContainerInfo(containerName)
+		if err != nil {
+			return fmt.Errorf("LoadContainerInfo() %s error %v", containerName, err)
+		}
+		containerInfo.RefreshStatus()
+		running := containerInfo.Status == container.STATUS_RUNNING || containerInfo.Status == container.STATUS_PAUSED
+
+		entries, pending, err = readLogEntries(reader, pending)
+		if err != nil {
+			return fmt.Errorf("readLogEntries() %s error %v", logFilePath, err)
+		}
+		for _, entry := range filterLogEntries(entries, since, -1) {
+			printLogEntry(entry, option.Timestamps)
+		}
+
+		// The log read after the container exits is complete.
+		if !running {
+			return nil
+		}
+		time.Sleep(LOGS_POLL_INTERVAL)
+	}
+}
+
+// Read entries until EOF.
+// An incomplete last line is returned as pending and should be passed back
+// in the next call.
+func readLogEntries(reader *bufio.Reader, pending []byte) ([]*container.LogEntry, []byte, error) {
+	var entries []*container.LogEntry
+	for {
+		line, err := reader.ReadBytes('\n')
+		pending = append(pending, line...)
+		if err != nil {
+			if err == io.EOF {
+				return entries, pending, nil
+			}
+			return nil, nil, fmt.Errorf("ReadBytes() error %v", err)
+		}
+
+		entry := &container.LogEntry{}
+		if err := json.Unmarshal(pending, entry); err != nil {
+			log.Warnf("Unmarshal() log line %s error %v", pending, err)
+		} else {
+			entries = append(entries, entry)
+		}
+		pending = nil
+	}
+}
+
+// Keep entries not before since, and then keep at most the last tail ones.
+// A negative tail keeps all of them.
+func filterLogEntries(entries []*container.LogEntry, since time.Time, tail int) []*container.LogEntry {
+	var filtered []*container.LogEntry
+	for _, entry := range entries {
+		if entry.Time.Before(since) {
+			continue
+		}
+		filtered = append(filtered, entry)
+	}
+
+	if tail >= 0 && len(filtered) > tail {
+		filtered = filtered[len(filtered)-tail:]
+	}
+
+	return filtered
+}
+
+func printLogEntry(entry *container.LogEntry, timestamps bool) {
+	out := os.Stdout
+	if entry.Stream == container.LOG_STREAM_STDERR {
+		out = os.Stderr
+	}
+	if timestamps {
+		fmt.Fprintf(out, "%s %s", entry.Time.Format(time.RFC3339Nano), entry.Log)
+	} else {
+		fmt.Fprint(out, entry.Log)
+	}
+}
+
+// Parse since as a RFC3339 time, a Unix timestamp or a duration relative to now
+// like 10m. An empty since means the beginning of time.
+func parseSince(since string, now time.Time) (time.Time, error) {
+	if len(since) == 0 {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, since); err == nil {
+		return t, nil
+	}
+	if sec, err := strconv.ParseInt(since, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	if d, err := time.ParseDuration(since); err == nil {
+		return now.Add(-d), nil
+	}
+
+	return time.Time{}, fmt.Errorf("Invalid time %s", since)
+}
@@ -0,0 +1,68 @@
+package command
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_readLogEntries(t *testing.T) {
+	content := `{"log":"a\n","stream":"stdout","time":"2020-01-01T00:00:00Z"}
+{"log":"b\n","stream":"stderr","time":"2020-01-01T00:00:01Z"}
+{"log":"c\n","stream":"std`
+	reader := bufio.NewReader(strings.NewReader(content))
+	entries, pending, err := readLogEntries(reader, nil)
+	if err != nil {
+		t.Fatalf("readLogEntries() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("readLogEntries() got %d entries, want 2", len(entries))
+	}
+
+	// The incomplete line is finished by a later write.
+	reader = bufio.NewReader(strings.NewReader(`out","time":"2020-01-01T00:00:02Z"}` + "\n"))
+	entries, pending, err = readLogEntries(reader, pending)
+	if err != nil {
+		t.Fatalf("readLogEntries() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].Log != "c\n" || len(pending) != 0 {
+		t.Errorf("readLogEntries() = %v, pending %q", entries, pending)
+	}
+}
+
+func Test_filterLogEntries(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader(`{"log":"a\n","stream":"stdout","time":"2020-01-01T00:00:00Z"}
+{"log":"b\n","stream":"stdout","time":"2020-01-01T00:00:01Z"}
+{"log":"c\n","stream":"stdout","time":"2020-01-01T00:00:02Z"}
+`))
+	entries, _, err := readLogEntries(reader, nil)
+	if err != nil {
+		t.Fatalf("readLogEntries() error = %v", err)
+	}
+
+	since := time.Date(2020, 1, 1, 0, 0, 1, 0, time.UTC)
+	tests := []struct {
+		name  string
+		since time.Time
+		tail  int
+		want  string
+	}{
+		{name: "all", tail: -1, want: "a\nb\nc\n"},
+		{name: "tail", tail: 1, want: "c\n"},
+		{name: "tail zero", tail: 0, want: ""},
+		{name: "since", since: since, tail: -1, want: "b\nc\n"},
+		{name: "since and tail", since: since, tail: 5, want: "b\nc\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got strings.Builder
+			for _, entry := range filterLogEntries(entries, tt.since, tt.tail) {
+				got.WriteString(entry.Log)
+			}
+			if got.String() != tt.want {
+				t.Errorf("filterLogEntries() = %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
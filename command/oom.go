@@ -0,0 +1,82 @@
+package command
+
+import (
+	"sync"
+
+	"github.com/chengzeyi/dicker/cgroups"
+	"github.com/chengzeyi/dicker/container"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Emit an event on every OOM event of a container while it is running.
+type oomWatcher struct {
+	containerInfo *container.ContainerInfo
+	cgroupManager *cgroups.CgroupManager
+	startCount    int
+	done          chan struct{}
+	wg            sync.WaitGroup
+	emitted       int
+}
+
+// The OOM kill counter of the cgroup accumulates over restarts, so only the
+// increase since now counts.
+func startOOMWatcher(containerInfo *container.ContainerInfo) *oomWatcher {
+	// The info is overwritten when the container exits, so keep a copy.
+	info := *containerInfo
+	w := &oomWatcher{
+		containerInfo: &info,
+		cgroupManager: cgroups.NewCgroupManager(containerInfo.CgroupPath),
+		done:          make(chan struct{}),
+	}
+
+	count, err := w.cgroupManager.OOMKillCount()
+	if err != nil {
+		log.Warnf("OOMKillCount() of cgroup %s error %v", containerInfo.CgroupPath, err)
+	}
+	w.startCount = count
+
+	ch, err := w.cgroupManager.NotifyOOM(w.done)
+	if err != nil {
+		log.Warnf("NotifyOOM() of cgroup %s error %v", containerInfo.CgroupPath, err)
+		return w
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		for range ch {
+			w.emit()
+		}
+	}()
+
+	return w
+}
+
+func (w *oomWatcher) emit() {
+	w.emitted++
+
+	log.Warnf("Container %s is out of memory", w.containerInfo.Name)
+	if err := container.EmitEvent(w.containerInfo, container.EVENT_OOM, nil); err != nil {
+		log.Errorf("EmitEvent() %s of %s error %v", container.EVENT_OOM, w.containerInfo.Name, err)
+	}
+}
+
+// Stop watching and return whether any process is killed by the OOM killer
+// since the watcher starts.
+// An OOM kill right before the container exits may not be notified yet, so the
+// counter is checked again and the missed event is emitted.
+func (w *oomWatcher) stop() bool {
+	close(w.done)
+	w.wg.Wait()
+
+	count, err := w.cgroupManager.OOMKillCount()
+	if err != nil {
+		log.Warnf("OOMKillCount() of cgroup %s error %v", w.containerInfo.CgroupPath, err)
+		return w.emitted > 0
+	}
+	if count > w.startCount && w.emitted == 0 {
+		w.emit()
+	}
+
+	return count > w.startCount || w.emitted > 0
+}
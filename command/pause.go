@@ -0,0 +1,86 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/chengzeyi/dicker/cgroups"
+	"github.com/chengzeyi/dicker/container"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Pause the containers one by one.
+// The returned error is the last occurred error.
+func Pause(containerNames []string) error {
+	var retErr error
+	for _, containerName := range containerNames {
+		if err := pauseContainer(containerName); err != nil {
+			retErr = fmt.Errorf("pauseContainer() %s error %v", containerName, err)
+			log.Error(retErr.Error())
+		}
+	}
+
+	return retErr
+}
+
+// Unpause the containers one by one.
+// The returned error is the last occurred error.
+func Unpause(containerNames []string) error {
+	var retErr error
+	for _, containerName := range containerNames {
+		if err := unpauseContainer(containerName); err != nil {
+			retErr = fmt.Errorf("unpauseContainer() %s error %v", containerName, err)
+			log.Error(retErr.Error())
+		}
+	}
+
+	return retErr
+}
+
+// Freeze every process in the container cgroup.
+func pauseContainer(containerName string) error {
+	containerInfo, unlock, err := container.LoadContainerInfoLocked(containerName)
+	if err != nil {
+		return fmt.Errorf("LoadContainerInfoLocked() %s error %v", containerName, err)
+	}
+	defer unlock()
+	containerInfo.RefreshStatus()
+	if containerInfo.Status != container.STATUS_RUNNING {
+		return fmt.Errorf("Container %s is %s, not running", containerName, containerInfo.Status)
+	}
+
+	if err := cgroups.NewCgroupManager(containerInfo.CgroupPath).Freeze(); err != nil {
+		return fmt.Errorf("Freeze() cgroup %s error %v", containerInfo.CgroupPath, err)
+	}
+
+	containerInfo.Status = container.STATUS_PAUSED
+	if err := containerInfo.Dump(); err != nil {
+		return fmt.Errorf("Dump() %v error %v", containerInfo, err)
+	}
+
+	return nil
+}
+
+// Thaw every process in the container cgroup.
+func unpauseContainer(containerName string) error {
+	containerInfo, unlock, err := container.LoadContainerInfoLocked(containerName)
+	if err != nil {
+		return fmt.Errorf("LoadContainerInfoLocked() %s error %v", containerName, err)
+	}
+	defer unlock()
+	containerInfo.RefreshStatus()
+	if containerInfo.Status != container.STATUS_PAUSED {
+		return fmt.Errorf("Container %s is %s, not paused", containerName, containerInfo.Status)
+	}
+
+	if err := cgroups.NewCgroupManager(containerInfo.CgroupPath).Thaw(); err != nil {
+		return fmt.Errorf("Thaw() cgroup %s error %v", containerInfo.CgroupPath, err)
+	}
+
+	containerInfo.Status = container.STATUS_RUNNING
+	if err := containerInfo.Dump(); err != nil {
+		return fmt.Errorf("Dump() %v error %v", containerInfo, err)
+	}
+
+	return nil
+}
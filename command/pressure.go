@@ -0,0 +1,86 @@
+package command
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chengzeyi/dicker/cgroups"
+	"github.com/chengzeyi/dicker/container"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const PRESSURE_POLL_INTERVAL = time.Second
+
+// Emit an event whenever the memory pressure of a container rises above its
+// threshold while it is running.
+// The pressure is the avg10 of the time some tasks are stalled on memory.
+type pressureWatcher struct {
+	containerInfo *container.ContainerInfo
+	cgroupManager *cgroups.CgroupManager
+	done          chan struct{}
+	wg            sync.WaitGroup
+}
+
+func startPressureWatcher(containerInfo *container.ContainerInfo) *pressureWatcher {
+	// The info is overwritten when the container exits, so keep a copy.
+	info := *containerInfo
+	w := &pressureWatcher{
+		containerInfo: &info,
+		cgroupManager: cgroups.NewCgroupManager(containerInfo.CgroupPath),
+		done:          make(chan struct{}),
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(PRESSURE_POLL_INTERVAL)
+		defer ticker.Stop()
+		// Only emit once until the pressure drops below the threshold.
+		exceeded := false
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+			}
+
+			stats, err := w.cgroupManager.GetStats()
+			if err != nil {
+				log.Warnf("GetStats() cgroup %s error %v", w.containerInfo.CgroupPath, err)
+				continue
+			}
+			if stats.MemoryPressure == nil {
+				continue
+			}
+			if stats.MemoryPressure.Some.Avg10 <= w.containerInfo.MemoryPressureThreshold {
+				exceeded = false
+				continue
+			}
+			if !exceeded {
+				exceeded = true
+				w.emit(stats.MemoryPressure)
+			}
+		}
+	}()
+
+	return w
+}
+
+func (w *pressureWatcher) emit(pressure *cgroups.Pressure) {
+	log.Warnf("Memory pressure %.2f%% of container %s exceeds %.2f%%", pressure.Some.Avg10, w.containerInfo.Name, w.containerInfo.MemoryPressureThreshold)
+	attributes := map[string]string{
+		"avg10":     fmt.Sprintf("%.2f", pressure.Some.Avg10),
+		"avg60":     fmt.Sprintf("%.2f", pressure.Some.Avg60),
+		"threshold": fmt.Sprintf("%.2f", w.containerInfo.MemoryPressureThreshold),
+	}
+	if err := container.EmitEvent(w.containerInfo, container.EVENT_MEMORY_PRESSURE, attributes); err != nil {
+		log.Errorf("EmitEvent() %s of %s error %v", container.EVENT_MEMORY_PRESSURE, w.containerInfo.Name, err)
+	}
+}
+
+func (w *pressureWatcher) stop() {
+	close(w.done)
+	w.wg.Wait()
+}
@@ -0,0 +1,132 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/chengzeyi/dicker/container"
+)
+
+type PsOption struct {
+	All     bool
+	Quiet   bool
+	Filters []string
+}
+
+// List containers recorded under container.DEFAULT_INFO_DIR_PATH.
+func Ps(option *PsOption) error {
+	filters, err := parsePsFilters(option.Filters)
+	if err != nil {
+		return fmt.Errorf("parsePsFilters() %v error %v", option.Filters, err)
+	}
+
+	containerInfos, err := container.ListContainerInfos()
+	if err != nil {
+		return fmt.Errorf("ListContainerInfos() error %v", err)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	if !option.Quiet {
+		fmt.Fprint(writer, "CONTAINER_ID\tNAME\tIMAGE\tCOMMAND\tCREATED\tSTATUS\tRESTARTS\tPORTS\n")
+	}
+	for _, containerInfo := range containerInfos {
+		containerInfo.RefreshStatus()
+		if !option.All && containerInfo.Status != container.STATUS_RUNNING && containerInfo.Status != container.STATUS_RESTARTING &&
+			containerInfo.Status != container.STATUS_PAUSED {
+			continue
+		}
+		if !matchPsFilters(containerInfo, filters) {
+			continue
+		}
+
+		if option.Quiet {
+			fmt.Fprintf(writer, "%s\n", containerInfo.Id)
+		} else {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+				containerInfo.Id,
+				containerInfo.Name,
+				containerInfo.Image,
+				containerInfo.Command,
+				containerInfo.CreateTime,
+				formatPsStatus(containerInfo),
+				containerInfo.RestartCount,
+				strings.Join(containerInfo.PortMappings, ","))
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("Flush() error %v", err)
+	}
+
+	return nil
+}
+
+// Show the exit code of a finished container, and whether it is killed by the
+// OOM killer, like 'exited (137, OOMKilled)'.
+func formatPsStatus(containerInfo *container.ContainerInfo) string {
+	if containerInfo.Status != container.STATUS_EXITED && containerInfo.Status != container.STATUS_STOPPED {
+		return containerInfo.Status
+	}
+	if containerInfo.OOMKilled {
+		return fmt.Sprintf("%s (%d, OOMKilled)", containerInfo.Status, containerInfo.ExitCode)
+	}
+	return fmt.Sprintf("%s (%d)", containerInfo.Status, containerInfo.ExitCode)
+}
+
+type psFilter struct {
+	key   string
+	value string
+}
+
+// Parse filters of the form key=value.
+// Supported keys are name, status and label.
+// A label filter value is either key or key=value.
+func parsePsFilters(filterStrs []string) ([]psFilter, error) {
+	var filters []psFilter
+	for _, filterStr := range filterStrs {
+		if len(strings.TrimSpace(filterStr)) == 0 {
+			continue
+		}
+		kv := strings.SplitN(filterStr, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Invalid filter %s", filterStr)
+		}
+		switch kv[0] {
+		case "name", "status", "label":
+		default:
+			return nil, fmt.Errorf("Unknown filter key %s", kv[0])
+		}
+		filters = append(filters, psFilter{key: kv[0], value: kv[1]})
+	}
+
+	return filters, nil
+}
+
+// All the filters must match.
+func matchPsFilters(containerInfo *container.ContainerInfo, filters []psFilter) bool {
+	for _, filter := range filters {
+		switch filter.key {
+		case "name":
+			if !strings.Contains(containerInfo.Name, filter.value) {
+				return false
+			}
+		case "status":
+			if containerInfo.Status != filter.value {
+				return false
+			}
+		case "label":
+			kv := strings.SplitN(filter.value, "=", 2)
+			val, ok := containerInfo.Labels[kv[0]]
+			if !ok {
+				return false
+			}
+			if len(kv) == 2 && val != kv[1] {
+				return false
+			}
+		}
+	}
+
+	return true
+}
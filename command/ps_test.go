@@ -0,0 +1,85 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/chengzeyi/dicker/container"
+)
+
+func Test_matchPsFilters(t *testing.T) {
+	containerInfo := &container.ContainerInfo{
+		Name:   "web-1",
+		Status: container.STATUS_RUNNING,
+		Labels: map[string]string{
+			"team": "infra",
+			"tier": "",
+		},
+	}
+
+	tests := []struct {
+		name       string
+		filterStrs []string
+		want       bool
+	}{
+		{
+			name:       "no filter",
+			filterStrs: []string{""},
+			want:       true,
+		},
+		{
+			name:       "name substring",
+			filterStrs: []string{"name=web"},
+			want:       true,
+		},
+		{
+			name:       "status mismatch",
+			filterStrs: []string{"status=" + container.STATUS_EXITED},
+			want:       false,
+		},
+		{
+			name:       "label key",
+			filterStrs: []string{"label=tier"},
+			want:       true,
+		},
+		{
+			name:       "label key and value",
+			filterStrs: []string{"label=team=infra", "name=web-1"},
+			want:       true,
+		},
+		{
+			name:       "label value mismatch",
+			filterStrs: []string{"label=team=dev"},
+			want:       false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters, err := parsePsFilters(tt.filterStrs)
+			if err != nil {
+				t.Fatalf("parsePsFilters() error = %v", err)
+			}
+			if got := matchPsFilters(containerInfo, filters); got != tt.want {
+				t.Errorf("matchPsFilters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_formatPsStatus(t *testing.T) {
+	tests := []struct {
+		containerInfo container.ContainerInfo
+		want          string
+	}{
+		{containerInfo: container.ContainerInfo{Status: container.STATUS_RUNNING}, want: container.STATUS_RUNNING},
+		{containerInfo: container.ContainerInfo{Status: container.STATUS_EXITED, ExitCode: 1}, want: "exited (1)"},
+		{containerInfo: container.ContainerInfo{Status: container.STATUS_EXITED, ExitCode: 137, OOMKilled: true}, want: "exited (137, OOMKilled)"},
+		{containerInfo: container.ContainerInfo{Status: container.STATUS_STOPPED, ExitCode: 143}, want: "stopped (143)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := formatPsStatus(&tt.containerInfo); got != tt.want {
+				t.Errorf("formatPsStatus() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chengzeyi/dicker/container"
+)
+
+const (
+	RESTART_POLICY_NO             = "no"
+	RESTART_POLICY_ON_FAILURE     = "on-failure"
+	RESTART_POLICY_ALWAYS         = "always"
+	RESTART_POLICY_UNLESS_STOPPED = "unless-stopped"
+
+	// The delay before a restart doubles after each restart.
+	RESTART_BACKOFF_MIN = 100 * time.Millisecond
+	RESTART_BACKOFF_MAX = time.Minute
+	// The delay is reset if the container has run for this long.
+	RESTART_BACKOFF_RESET = 10 * time.Second
+	// Recorded as the exit code of a container failing to restart, so that
+	// it is retried like a failed exit.
+	START_FAILURE_EXIT_CODE = 128
+)
+
+// Parse a restart policy of the form no, on-failure[:N], always or
+// unless-stopped.
+// maxRetries is only meaningful for on-failure and 0 means unlimited.
+func parseRestartPolicy(policy string) (string, int, error) {
+	if len(policy) == 0 {
+		return RESTART_POLICY_NO, 0, nil
+	}
+
+	nameAndRetries := strings.SplitN(policy, ":", 2)
+	name := nameAndRetries[0]
+	switch name {
+	case RESTART_POLICY_NO, RESTART_POLICY_ALWAYS, RESTART_POLICY_UNLESS_STOPPED:
+		if len(nameAndRetries) == 2 {
+			return "", 0, fmt.Errorf("Maximum retry count is only allowed for %s", RESTART_POLICY_ON_FAILURE)
+		}
+		return name, 0, nil
+	case RESTART_POLICY_ON_FAILURE:
+		if len(nameAndRetries) == 1 {
+			return name, 0, nil
+		}
+		maxRetries, err := strconv.Atoi(nameAndRetries[1])
+		if err != nil || maxRetries < 0 {
+			return "", 0, fmt.Errorf("Invalid maximum retry count %s", nameAndRetries[1])
+		}
+		return name, maxRetries, nil
+	default:
+		return "", 0, fmt.Errorf("Unknown restart policy %s", policy)
+	}
+}
+
+// Decide whether the exited container should be restarted by its shim.
+// A container stopped by 'dicker stop' is never restarted.
+// Without a daemon surviving host reboots, always and unless-stopped
+// behave the same.
+func shouldRestart(containerInfo *container.ContainerInfo) bool {
+	if containerInfo.ManuallyStopped {
+		return false
+	}
+
+	name, maxRetries, err := parseRestartPolicy(containerInfo.RestartPolicy)
+	if err != nil {
+		return false
+	}
+	switch name {
+	case RESTART_POLICY_ALWAYS, RESTART_POLICY_UNLESS_STOPPED:
+		return true
+	case RESTART_POLICY_ON_FAILURE:
+		if containerInfo.ExitCode == 0 {
+			return false
+		}
+		return maxRetries == 0 || containerInfo.RestartCount < maxRetries
+	default:
+		return false
+	}
+}
+
+// Return the next restart delay.
+func nextRestartBackoff(backoff, uptime time.Duration) time.Duration {
+	if uptime >= RESTART_BACKOFF_RESET || backoff < RESTART_BACKOFF_MIN {
+		return RESTART_BACKOFF_MIN
+	}
+	backoff *= 2
+	if backoff > RESTART_BACKOFF_MAX {
+		backoff = RESTART_BACKOFF_MAX
+	}
+
+	return backoff
+}
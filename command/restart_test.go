@@ -0,0 +1,100 @@
+package command
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chengzeyi/dicker/container"
+)
+
+func Test_parseRestartPolicy(t *testing.T) {
+	tests := []struct {
+		policy         string
+		wantName       string
+		wantMaxRetries int
+		wantErr        bool
+	}{
+		{policy: "", wantName: RESTART_POLICY_NO},
+		{policy: "no", wantName: RESTART_POLICY_NO},
+		{policy: "always", wantName: RESTART_POLICY_ALWAYS},
+		{policy: "unless-stopped", wantName: RESTART_POLICY_UNLESS_STOPPED},
+		{policy: "on-failure", wantName: RESTART_POLICY_ON_FAILURE},
+		{policy: "on-failure:3", wantName: RESTART_POLICY_ON_FAILURE, wantMaxRetries: 3},
+		{policy: "on-failure:-1", wantErr: true},
+		{policy: "always:3", wantErr: true},
+		{policy: "sometimes", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			name, maxRetries, err := parseRestartPolicy(tt.policy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRestartPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if name != tt.wantName || maxRetries != tt.wantMaxRetries {
+				t.Errorf("parseRestartPolicy() = %s, %d, want %s, %d", name, maxRetries, tt.wantName, tt.wantMaxRetries)
+			}
+		})
+	}
+}
+
+func Test_shouldRestart(t *testing.T) {
+	tests := []struct {
+		name          string
+		containerInfo container.ContainerInfo
+		want          bool
+	}{
+		{
+			name:          "no",
+			containerInfo: container.ContainerInfo{RestartPolicy: "no", ExitCode: 1},
+			want:          false,
+		},
+		{
+			name:          "always after success",
+			containerInfo: container.ContainerInfo{RestartPolicy: "always"},
+			want:          true,
+		},
+		{
+			name:          "always after manual stop",
+			containerInfo: container.ContainerInfo{RestartPolicy: "always", ManuallyStopped: true},
+			want:          false,
+		},
+		{
+			name:          "on-failure after success",
+			containerInfo: container.ContainerInfo{RestartPolicy: "on-failure"},
+			want:          false,
+		},
+		{
+			name:          "on-failure within retries",
+			containerInfo: container.ContainerInfo{RestartPolicy: "on-failure:2", ExitCode: 1, RestartCount: 1},
+			want:          true,
+		},
+		{
+			name:          "on-failure out of retries",
+			containerInfo: container.ContainerInfo{RestartPolicy: "on-failure:2", ExitCode: 1, RestartCount: 2},
+			want:          false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldRestart(&tt.containerInfo); got != tt.want {
+				t.Errorf("shouldRestart() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_nextRestartBackoff(t *testing.T) {
+	backoff := nextRestartBackoff(0, 0)
+	if backoff != RESTART_BACKOFF_MIN {
+		t.Fatalf("nextRestartBackoff() = %v, want %v", backoff, RESTART_BACKOFF_MIN)
+	}
+	if got := nextRestartBackoff(backoff, time.Second); got != 2*RESTART_BACKOFF_MIN {
+		t.Errorf("nextRestartBackoff() = %v, want %v", got, 2*RESTART_BACKOFF_MIN)
+	}
+	if got := nextRestartBackoff(RESTART_BACKOFF_MAX, time.Second); got != RESTART_BACKOFF_MAX {
+		t.Errorf("nextRestartBackoff() = %v, want %v", got, RESTART_BACKOFF_MAX)
+	}
+	if got := nextRestartBackoff(RESTART_BACKOFF_MAX, RESTART_BACKOFF_RESET); got != RESTART_BACKOFF_MIN {
+		t.Errorf("nextRestartBackoff() = %v, want %v", got, RESTART_BACKOFF_MIN)
+	}
+}
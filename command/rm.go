@@ -0,0 +1,85 @@
+package command
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/chengzeyi/dicker/cgroups"
+	"github.com/chengzeyi/dicker/container"
+	"github.com/chengzeyi/dicker/volume"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type RmOption struct {
+	Force   bool
+	Volumes bool
+}
+
+// Remove the containers one by one.
+// The returned error is the last occurred error.
+func Rm(option *RmOption, containerNames []string) error {
+	var retErr error
+	for _, containerName := range containerNames {
+		if err := removeContainer(containerName, option.Force, option.Volumes); err != nil {
+			retErr = fmt.Errorf("removeContainer() %s error %v", containerName, err)
+			log.Error(retErr.Error())
+		}
+	}
+
+	return retErr
+}
+
+// Tear down everything the container owns on the host.
+// The info directory is deleted last so that a failed removal can be retried.
+func removeContainer(containerName string, force, volumes bool) error {
+	containerInfo, err := container.LoadContainerInfo(containerName)
+	if err != nil {
+		return fmt.Errorf("LoadContainerInfo() %s error %v", containerName, err)
+	}
+
+	containerInfo.RefreshStatus()
+	if containerInfo.Status == container.STATUS_RUNNING || containerInfo.Status == container.STATUS_RESTARTING ||
+		containerInfo.Status == container.STATUS_PAUSED {
+		if !force {
+			return fmt.Errorf("Container %s is running, stop it first or use --force", containerName)
+		}
+		if err := stopContainer(containerName, syscall.SIGKILL, 10*time.Second); err != nil {
+			return fmt.Errorf("stopContainer() %s error %v", containerName, err)
+		}
+	}
+
+	if err := container.DeleteWorkspace(containerInfo.Mounts, containerName); err != nil {
+		return fmt.Errorf("DeleteWorkspace() %s error %v", containerName, err)
+	}
+	if volumes {
+		if err := container.DeleteVolumeData(containerInfo.Mounts); err != nil {
+			return fmt.Errorf("DeleteVolumeData() %v error %v", containerInfo.Mounts, err)
+		}
+	}
+	for _, m := range containerInfo.Mounts {
+		if len(m.Name) == 0 {
+			continue
+		}
+		if err := volume.ReleaseVolume(m.Name, containerInfo.Id); err != nil {
+			return fmt.Errorf("ReleaseVolume() %s error %v", m.Name, err)
+		}
+	}
+
+	if len(containerInfo.CgroupPath) != 0 {
+		if err := cgroups.NewCgroupManager(containerInfo.CgroupPath).Destroy(); err != nil {
+			return fmt.Errorf("Destroy() cgroup %s error %v", containerInfo.CgroupPath, err)
+		}
+	}
+
+	if err := cgroups.CpusAllocator.Release(containerInfo.Id); err != nil {
+		return fmt.Errorf("Release() exclusive CPUs of %s error %v", containerInfo.Id, err)
+	}
+
+	if err := containerInfo.Remove(); err != nil {
+		return fmt.Errorf("Remove() %s error %v", containerName, err)
+	}
+
+	return nil
+}
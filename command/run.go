@@ -1,125 +1,688 @@
 package command
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
-	"path/filepath"
+	"os/exec"
+	"path"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/chengzeyi/dicker/cgroups"
 	"github.com/chengzeyi/dicker/container"
 	"github.com/chengzeyi/dicker/util"
+	"github.com/chengzeyi/dicker/volume"
 
 	log "github.com/sirupsen/logrus"
 )
 
 type RunOption struct {
-	Tty           bool
-	ContainerName string
-	VolumeMapping string
-	PortMappings  []string
-	Envs          []string
+	Tty                     bool
+	ContainerName           string
+	Volumes                 []string
+	Tmpfs                   []string
+	PortMappings            []string
+	Envs                    []string
+	EnvFiles                []string
+	WorkDir                 string
+	Hostname                string
+	User                    string
+	Ulimits                 []string
+	Labels                  []string
+	RestartPolicy           string
+	Memory                  string
+	CpuShares               string
+	CpusetCpus              string
+	Cpus                    string
+	CpusExclusive           string
+	CpuPeriod               string
+	CpuQuota                string
+	MemorySwap              string
+	MemoryReservation       string
+	PidsLimit               string
+	DeviceReadBps           []string
+	DeviceWriteBps          []string
+	DeviceReadIops          []string
+	DeviceWriteIops         []string
+	HugetlbLimits           []string
+	CgroupParent            string
+	MemoryPressureThreshold string
 }
 
+const (
+	// Container cgroups are created under this parent unless --cgroup-parent
+	// is given.
+	DEFAULT_CGROUP_PARENT = "dicker"
+	// CFS period used to convert --cpus to a quota.
+	DEFAULT_CPU_PERIOD = 100000
+)
+
 func Run(option *RunOption, imageName string, cmdArr []string) error {
 	containerName := option.ContainerName
 	tty := option.Tty
-	volumeMapping := option.VolumeMapping
-	portMappings := option.PortMappings
-	envs := option.Envs
 
 	containerId := util.GenRandStrBytes(10)
 	if len(containerName) == 0 {
 		containerName = containerId
 	}
 
-	parent, wPipe, err := container.NewParentProcess(tty, volumeMapping, imageName, containerName, envs)
+	restartPolicy, _, err := parseRestartPolicy(option.RestartPolicy)
 	if err != nil {
-		return fmt.Errorf("NewParentProcess() error %v", err)
+		return fmt.Errorf("parseRestartPolicy() %s error %v", option.RestartPolicy, err)
 	}
-	if err := parent.Start(); err != nil {
-		return fmt.Errorf("Start() parent process error %v", err)
+	if restartPolicy != RESTART_POLICY_NO && tty {
+		return fmt.Errorf("Restart policy %s conflicts with tty", option.RestartPolicy)
 	}
 
-	// Parent process in the container should wait here to read piped command.
+	hostname := option.Hostname
+	if len(hostname) == 0 {
+		hostname = containerId
+	}
 
-	// TODO: recordContainerInfo
-	if err := writeContainerInfo(parent.Process.Pid, cmdArr, portMappings, containerName, containerId, volumeMapping); err != nil {
-		return fmt.Errorf("recordContainerInfo() error %v", err)
+	envs, err := buildContainerEnvs(imageName, hostname, option.EnvFiles, option.Envs)
+	if err != nil {
+		return fmt.Errorf("buildContainerEnvs() error %v", err)
+	}
+
+	var rlimits []container.Rlimit
+	for _, ulimit := range option.Ulimits {
+		rlimit, err := container.ParseRlimit(ulimit)
+		if err != nil {
+			return fmt.Errorf("ParseRlimit() %s error %v", ulimit, err)
+		}
+		rlimits = append(rlimits, rlimit)
+	}
+
+	var mounts []*container.VolumeMount
+	for _, spec := range option.Volumes {
+		m, err := container.ParseVolumeMount(spec)
+		if err != nil {
+			return fmt.Errorf("ParseVolumeMount() %s error %v", spec, err)
+		}
+		if len(m.Name) != 0 {
+			if err := volume.ValidateVolumeName(m.Name); err != nil {
+				return fmt.Errorf("ValidateVolumeName() %s error %v", m.Name, err)
+			}
+		}
+		mounts = append(mounts, m)
+	}
+	for _, spec := range option.Tmpfs {
+		m, err := parseTmpfsMount(spec)
+		if err != nil {
+			return fmt.Errorf("parseTmpfsMount() %s error %v", spec, err)
+		}
+		mounts = append(mounts, m)
+	}
+
+	labelMap, err := parseLabels(option.Labels)
+	if err != nil {
+		return fmt.Errorf("parseLabels() %v error %v", option.Labels, err)
+	}
+
+	res, err := parseResourceConfig(option)
+	if err != nil {
+		return fmt.Errorf("parseResourceConfig() error %v", err)
+	}
+
+	cgroupParent, err := parseCgroupParent(option.CgroupParent)
+	if err != nil {
+		return fmt.Errorf("parseCgroupParent() %s error %v", option.CgroupParent, err)
+	}
+
+	memoryPressureThreshold, err := parseMemoryPressureThreshold(option.MemoryPressureThreshold)
+	if err != nil {
+		return fmt.Errorf("parseMemoryPressureThreshold() %s error %v", option.MemoryPressureThreshold, err)
+	}
+
+	// Claim the name before anything is set up, so that nothing of an
+	// existing container of the same name is touched.
+	if err := container.CreateContainerInfoDir(containerName); err != nil {
+		return fmt.Errorf("CreateContainerInfoDir() %s error %v", containerName, err)
+	}
+
+	// The CPUs are released when the container is removed.
+	if len(res.Cpuset) != 0 {
+		if err := shareCpus(containerId, res.Cpuset); err != nil {
+			releaseContainerName(containerName)
+			return fmt.Errorf("shareCpus() %s error %v", res.Cpuset, err)
+		}
+	}
+	if len(option.CpusExclusive) != 0 {
+		n, _ := strconv.Atoi(option.CpusExclusive)
+		cpus, err := cgroups.CpusAllocator.Alloc(containerId, n)
+		if err != nil {
+			releaseContainerName(containerName)
+			return fmt.Errorf("Alloc() %d exclusive CPUs error %v", n, err)
+		}
+		res.Cpuset = cgroups.FormatCpuList(cpus)
+		log.Infof("Allocate exclusive CPUs %s to container %s", res.Cpuset, containerName)
 	}
-	// TODO: NewCgroupManager
-	// TODO: config container network
 
-	// Send init command to parent process.
-	if err := sendInitCommand(cmdArr, wPipe); err != nil {
-		log.Errorf("sendInitCommand() %v error %v", cmdArr, err)
+	containerInfo := &container.ContainerInfo{
+		Id:                      containerId,
+		Name:                    containerName,
+		Image:                   imageName,
+		Command:                 strings.Join(cmdArr, " "),
+		Args:                    cmdArr,
+		Envs:                    envs,
+		WorkDir:                 option.WorkDir,
+		Hostname:                hostname,
+		User:                    option.User,
+		Rlimits:                 rlimits,
+		CreateTime:              time.Now().Format("2006-01-02 15:04:05"),
+		Status:                  container.STATUS_CREATED,
+		Mounts:                  mounts,
+		PortMappings:            option.PortMappings,
+		Labels:                  labelMap,
+		RestartPolicy:           option.RestartPolicy,
+		CgroupPath:              path.Join(cgroupParent, containerId),
+		Resources:               res,
+		MemoryPressureThreshold: memoryPressureThreshold,
+	}
+	// The volumes are released when the container is removed.
+	if err := acquireVolumes(containerId, mounts); err != nil {
+		releaseCpus(containerId)
+		releaseContainerName(containerName)
+		return fmt.Errorf("acquireVolumes() %s error %v", containerName, err)
+	}
+	if err := container.NewWorkspace(mounts, imageName, containerName); err != nil {
+		releaseCpus(containerId)
+		releaseVolumes(containerId, mounts)
+		releaseContainerName(containerName)
+		return fmt.Errorf("NewWorkspace() with image name %s and containerName %s error %v", imageName, containerName, err)
+	}
+	if err := containerInfo.Dump(); err != nil {
+		if err := container.DeleteWorkspace(mounts, containerName); err != nil {
+			log.Errorf("DeleteWorkspace() %s error %v. You may need to delete something manually", containerName, err)
+		}
+		releaseCpus(containerId)
+		releaseVolumes(containerId, mounts)
+		releaseContainerName(containerName)
+		return fmt.Errorf("Dump() %v error %v", containerInfo, err)
 	}
 
-	if err := wPipe.Close(); err != nil {
-		log.Error("Close() error %v", err)
+	if !tty {
+		// The shim starts the container and keeps supervising it after
+		// this process exits.
+		if err := startShim(containerName); err != nil {
+			if err := removeContainer(containerName, true, false); err != nil {
+				log.Errorf("removeContainer() %s error %v. You may need to delete something manually", containerName, err)
+			}
+			return fmt.Errorf("startShim() %s error %v", containerName, err)
+		}
+		return nil
 	}
 
-	if tty {
-		// Here the current tty of this process is piped to the parent process.
-		// Need to wait for the termination of the parent process.
-		// ExitError: The command fails to execute or doesn't complete successfully.
-		if err := parent.Wait(); err != nil {
-			log.Errorf("Wait() error %v", err)
+	unlock, err := container.LockContainerInfo(containerName)
+	if err != nil {
+		if err := removeContainer(containerName, true, false); err != nil {
+			log.Errorf("removeContainer() %s error %v. You may need to delete something manually", containerName, err)
 		}
-		// deleteContainerInfo
-		if err := container.DeleteWorkspace(volumeMapping, containerName); err != nil {
-			log.Errorf("DeleteWorkspace() volume mapping %s and container name %s error %v. You may need to delete something manually", volumeMapping, containerName, err)
+		return fmt.Errorf("LockContainerInfo() %s error %v", containerName, err)
+	}
+	parent, err := startContainer(containerInfo, true)
+	unlock()
+	if err != nil {
+		if err := removeContainer(containerName, true, false); err != nil {
+			log.Errorf("removeContainer() %s error %v. You may need to delete something manually", containerName, err)
 		}
+		return fmt.Errorf("startContainer() %s error %v", containerName, err)
+	}
+
+	// Here the current tty of this process is piped to the parent process.
+	// Need to wait for the termination of the parent process.
+	if err := waitContainer(parent, containerInfo); err != nil {
+		log.Errorf("waitContainer() %s error %v", containerName, err)
 	}
+	cleanupContainer(containerInfo)
 
 	return nil
 }
 
-func sendInitCommand(cmdArr []string, wPipe *os.File) error {
-	command := strings.Join(cmdArr, " ")
-	log.Infof("Full init command is %s", command)
-	if _, err := wPipe.WriteString(command); err != nil {
-		return fmt.Errorf("WriteString() %s error %v", command, err)
+// Tear down the workspace and the cgroup of a container that exits for the
+// last time. The rest is kept for inspect and logs until the container is
+// removed, and rm tolerates what is already deleted here.
+func cleanupContainer(containerInfo *container.ContainerInfo) {
+	if err := container.DeleteWorkspace(containerInfo.Mounts, containerInfo.Name); err != nil {
+		log.Errorf("DeleteWorkspace() %s error %v. You may need to delete something manually", containerInfo.Name, err)
+	}
+	if len(containerInfo.CgroupPath) != 0 {
+		if err := cgroups.NewCgroupManager(containerInfo.CgroupPath).Destroy(); err != nil {
+			log.Errorf("Destroy() cgroup %s error %v. You may need to delete something manually", containerInfo.CgroupPath, err)
+		}
 	}
+}
 
-	return nil
+// Start the init process of the container in its workspace, send it the init
+// config and wait until it executes the user command.
+// The returned process is the child of this process and should be waited.
+// The caller should hold the lock of the container info.
+func startContainer(containerInfo *container.ContainerInfo, tty bool) (*exec.Cmd, error) {
+	parent, wConfig, rResult, err := container.NewParentProcess(tty, containerInfo.Name)
+	if err != nil {
+		return nil, fmt.Errorf("NewParentProcess() error %v", err)
+	}
+	defer wConfig.Close()
+	defer rResult.Close()
+	err = parent.Start()
+	// The child ends are inherited by the init process now.
+	// Close them so that reading the result gets EOF once the init process
+	// executes the user command or exits.
+	for _, f := range parent.ExtraFiles {
+		f.Close()
+	}
+	if !tty {
+		// The log pipes are inherited by the parent process now, if it is
+		// started. Close them so that the logger gets EOF once the container
+		// exits, or at once.
+		parent.Stdout.(*os.File).Close()
+		parent.Stderr.(*os.File).Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Start() parent process error %v", err)
+	}
+
+	// Kill the init process and anything it may have left in the cgroup
+	// if the container fails to start.
+	cgroupManager := cgroups.NewCgroupManager(containerInfo.CgroupPath)
+	kill := func() {
+		parent.Process.Kill()
+		parent.Wait()
+		if err := cgroupManager.Destroy(); err != nil {
+			log.Errorf("Destroy() cgroup %s error %v", containerInfo.CgroupPath, err)
+		}
+	}
+
+	// Parent process in the container should wait here to read piped command.
+
+	containerInfo.Pid = parent.Process.Pid
+	containerInfo.Status = container.STATUS_RUNNING
+	containerInfo.FinishTime = ""
+	containerInfo.ExitCode = 0
+	containerInfo.OOMKilled = false
+	containerInfo.Error = ""
+	containerInfo.ManuallyStopped = false
+	if err := containerInfo.Dump(); err != nil {
+		kill()
+		return nil, fmt.Errorf("Dump() %v error %v", containerInfo, err)
+	}
+
+	// The init process is blocked on reading the pipe, so the limitations
+	// take effect before the user command starts.
+	res := containerInfo.Resources
+	if res == nil {
+		res = &cgroups.ResourceConfig{}
+	}
+	if err := cgroupManager.Set(res); err != nil {
+		kill()
+		return nil, fmt.Errorf("Set() cgroup %s error %v", containerInfo.CgroupPath, err)
+	}
+	if err := cgroupManager.Apply(parent.Process.Pid); err != nil {
+		kill()
+		return nil, fmt.Errorf("Apply() cgroup %s error %v", containerInfo.CgroupPath, err)
+	}
+
+	// TODO: config container network
+
+	initConfig := newInitConfig(containerInfo)
+	log.Infof("Full init command is %q", initConfig.Args)
+	if err := container.WriteInitConfig(wConfig, initConfig); err != nil {
+		kill()
+		return nil, fmt.Errorf("WriteInitConfig() error %v", err)
+	}
+	wConfig.Close()
+	if err := container.ReadInitResult(rResult); err != nil {
+		kill()
+		return nil, fmt.Errorf("Init container %s error %v", containerInfo.Name, err)
+	}
+
+	return parent, nil
 }
 
-func writeContainerInfo(containerPid int, cmdArr, portMappings []string, name, id, volumeMapping string) error {
-	createTime := time.Now().Format("2006-01-02 15:04:05")
-	command := strings.Join(cmdArr, " ")
-	containerInfo := &container.ContainerInfo{
-		Pid: containerPid,
-		Id: id,
-		Name: name,
-		Command: command,
-		CreateTime: createTime,
-		Status: container.STATUS_RUNNING,
-		VolumeMapping: volumeMapping,
-		PortMappings: portMappings,
+func newInitConfig(containerInfo *container.ContainerInfo) *container.InitConfig {
+	return &container.InitConfig{
+		Version:  container.INIT_CONFIG_VERSION,
+		Args:     containerInfo.Args,
+		Envs:     containerInfo.Envs,
+		Cwd:      containerInfo.WorkDir,
+		Hostname: containerInfo.Hostname,
+		User:     containerInfo.User,
+		Mounts:   container.DefaultMounts(),
+		Rlimits:  containerInfo.Rlimits,
+	}
+}
+
+// Wait for the init process of the container and record how it exits.
+func waitContainer(parent *exec.Cmd, containerInfo *container.ContainerInfo) error {
+	// Watch OOM events while the container is running.
+	var oomWatcher *oomWatcher
+	var pressureWatcher *pressureWatcher
+	if len(containerInfo.CgroupPath) != 0 {
+		oomWatcher = startOOMWatcher(containerInfo)
+		if containerInfo.MemoryPressureThreshold > 0 {
+			pressureWatcher = startPressureWatcher(containerInfo)
+		}
 	}
 
-	jsonBytes, err := json.Marshal(containerInfo)
+	// ExitError: The command fails to execute or doesn't complete successfully.
+	err := parent.Wait()
+	if pressureWatcher != nil {
+		pressureWatcher.stop()
+	}
 	if err != nil {
-		return fmt.Errorf("Marshal() %v error %v", containerInfo, err)
+		if _, ok := err.(*exec.ExitError); !ok {
+			if oomWatcher != nil {
+				oomWatcher.stop()
+			}
+			return fmt.Errorf("Wait() error %v", err)
+		}
+	}
+
+	exitCode := parent.ProcessState.ExitCode()
+	if status, ok := parent.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		// Conventionally a process killed by a signal exits with 128 + signal.
+		exitCode = 128 + int(status.Signal())
 	}
 
-	jsonStr := string(jsonBytes)
+	// The info may have been changed by other dicker commands meanwhile.
+	latestInfo, unlock, err := container.LoadContainerInfoLocked(containerInfo.Name)
+	if err != nil {
+		log.Warnf("LoadContainerInfoLocked() %s error %v", containerInfo.Name, err)
+	} else {
+		defer unlock()
+		*containerInfo = *latestInfo
+	}
 
-	dirPath := filepath.Join(container.DEFAULT_INFO_DIR_PATH, name)
-	if err := os.MkdirAll(dirPath, 0622); err != nil {
-		return fmt.Errorf("MkdirAll() %s error %v", dirPath, err)
+	containerInfo.ExitCode = exitCode
+	containerInfo.FinishTime = time.Now().Format("2006-01-02 15:04:05")
+	if containerInfo.ManuallyStopped {
+		containerInfo.Status = container.STATUS_STOPPED
+	} else {
+		containerInfo.Status = container.STATUS_EXITED
 	}
-	filePath := filepath.Join(dirPath, container.CONFIG_FILE_NAME)
-	file, err := os.Create(filePath)
-	defer file.Close()
+	if oomWatcher != nil {
+		containerInfo.OOMKilled = oomWatcher.stop()
+	}
+	if err := containerInfo.Dump(); err != nil {
+		return fmt.Errorf("Dump() %v error %v", containerInfo, err)
+	}
+
+	return nil
+}
+
+// Convert the resource options to a cgroups.ResourceConfig.
+func parseResourceConfig(option *RunOption) (*cgroups.ResourceConfig, error) {
+	res := &cgroups.ResourceConfig{
+		CpuShares: option.CpuShares,
+		Cpuset:    option.CpusetCpus,
+	}
+
+	if len(option.Memory) != 0 {
+		memory, err := util.ParseByteSize(option.Memory)
+		if err != nil {
+			return nil, fmt.Errorf("ParseByteSize() %s error %v", option.Memory, err)
+		}
+		res.MemoryLimit = strconv.FormatInt(memory, 10)
+	}
+
+	// Like docker, the swap limit includes the memory and -1 means unlimited.
+	if len(option.MemorySwap) != 0 {
+		if len(res.MemoryLimit) == 0 {
+			return nil, fmt.Errorf("Memory swap limit requires memory limit")
+		}
+		if option.MemorySwap == "-1" {
+			res.MemorySwap = "-1"
+		} else {
+			memorySwap, err := util.ParseByteSize(option.MemorySwap)
+			if err != nil {
+				return nil, fmt.Errorf("ParseByteSize() %s error %v", option.MemorySwap, err)
+			}
+			if memory, _ := strconv.ParseInt(res.MemoryLimit, 10, 64); memorySwap < memory {
+				return nil, fmt.Errorf("Memory swap limit %s is less than memory limit %s", option.MemorySwap, option.Memory)
+			}
+			res.MemorySwap = strconv.FormatInt(memorySwap, 10)
+		}
+	}
+
+	if len(option.MemoryReservation) != 0 {
+		memoryReservation, err := util.ParseByteSize(option.MemoryReservation)
+		if err != nil {
+			return nil, fmt.Errorf("ParseByteSize() %s error %v", option.MemoryReservation, err)
+		}
+		res.MemoryReservation = strconv.FormatInt(memoryReservation, 10)
+	}
+
+	if len(option.CpusExclusive) != 0 {
+		if len(option.CpusetCpus) != 0 {
+			return nil, fmt.Errorf("Number of exclusive CPUs conflicts with cpuset CPUs")
+		}
+		if n, err := strconv.Atoi(option.CpusExclusive); err != nil || n <= 0 {
+			return nil, fmt.Errorf("Invalid number of exclusive CPUs %s", option.CpusExclusive)
+		}
+	}
+
+	if len(option.CpuShares) != 0 {
+		if shares, err := strconv.Atoi(option.CpuShares); err != nil || shares < 2 {
+			return nil, fmt.Errorf("Invalid CPU shares %s", option.CpuShares)
+		}
+	}
+
+	if len(option.Cpus) != 0 {
+		if len(option.CpuPeriod) != 0 || len(option.CpuQuota) != 0 {
+			return nil, fmt.Errorf("Number of CPUs conflicts with CPU period and quota")
+		}
+		cpus, err := strconv.ParseFloat(option.Cpus, 64)
+		if err != nil || cpus <= 0 {
+			return nil, fmt.Errorf("Invalid number of CPUs %s", option.Cpus)
+		}
+		res.CpuPeriod = strconv.Itoa(DEFAULT_CPU_PERIOD)
+		res.CpuQuota = strconv.Itoa(int(cpus * DEFAULT_CPU_PERIOD))
+	}
+
+	// The kernel accepts periods from 1ms to 1s and quotas no less than 1ms.
+	if len(option.CpuPeriod) != 0 {
+		if period, err := strconv.Atoi(option.CpuPeriod); err != nil || period < 1000 || period > 1000000 {
+			return nil, fmt.Errorf("Invalid CPU period %s", option.CpuPeriod)
+		}
+		res.CpuPeriod = option.CpuPeriod
+	}
+	if len(option.CpuQuota) != 0 {
+		if quota, err := strconv.Atoi(option.CpuQuota); err != nil || (quota < 1000 && quota != -1) {
+			return nil, fmt.Errorf("Invalid CPU quota %s", option.CpuQuota)
+		}
+		res.CpuQuota = option.CpuQuota
+	}
+
+	if len(option.PidsLimit) != 0 {
+		if _, err := strconv.ParseInt(option.PidsLimit, 10, 64); err != nil {
+			return nil, fmt.Errorf("Invalid pids limit %s", option.PidsLimit)
+		}
+		res.PidsLimit = option.PidsLimit
+	}
+
+	var err error
+	if res.BlkioThrottleReadBps, err = parseThrottleDevices(option.DeviceReadBps, true); err != nil {
+		return nil, fmt.Errorf("parseThrottleDevices() %v error %v", option.DeviceReadBps, err)
+	}
+	if res.BlkioThrottleWriteBps, err = parseThrottleDevices(option.DeviceWriteBps, true); err != nil {
+		return nil, fmt.Errorf("parseThrottleDevices() %v error %v", option.DeviceWriteBps, err)
+	}
+	if res.BlkioThrottleReadIops, err = parseThrottleDevices(option.DeviceReadIops, false); err != nil {
+		return nil, fmt.Errorf("parseThrottleDevices() %v error %v", option.DeviceReadIops, err)
+	}
+	if res.BlkioThrottleWriteIops, err = parseThrottleDevices(option.DeviceWriteIops, false); err != nil {
+		return nil, fmt.Errorf("parseThrottleDevices() %v error %v", option.DeviceWriteIops, err)
+	}
+
+	if res.HugetlbLimits, err = parseHugetlbLimits(option.HugetlbLimits); err != nil {
+		return nil, fmt.Errorf("parseHugetlbLimits() %v error %v", option.HugetlbLimits, err)
+	}
+
+	return res, nil
+}
+
+// The threshold is a percentage of the time some tasks are stalled on memory,
+// which is only reported on cgroup v2.
+func parseMemoryPressureThreshold(thresholdStr string) (float64, error) {
+	if len(thresholdStr) == 0 {
+		return 0, nil
+	}
+	threshold, err := strconv.ParseFloat(thresholdStr, 64)
+	if err != nil || threshold <= 0 || threshold >= 100 {
+		return 0, fmt.Errorf("Invalid memory pressure threshold %s", thresholdStr)
+	}
+	if cgroups.CgroupVersion() != cgroups.CGROUP_V2 {
+		return 0, fmt.Errorf("Memory pressure requires cgroup v2")
+	}
+
+	return threshold, nil
+}
+
+// Record the cpuset CPUs as used by the container, so that they are never
+// exclusively allocated to another container.
+// An empty cpuset drops the record.
+func shareCpus(containerId, cpusetCpus string) error {
+	cpus, err := cgroups.ParseCpuList(cpusetCpus)
 	if err != nil {
-		return fmt.Errorf("Create() %s error %v", filePath, err)
+		return fmt.Errorf("ParseCpuList() %s error %v", cpusetCpus, err)
 	}
-	if _, err := file.WriteString(jsonStr); err != nil {
-		return fmt.Errorf("WriteString() error %v", jsonStr)
+	if err := cgroups.CpusAllocator.Share(containerId, cpus); err != nil {
+		return fmt.Errorf("Share() %v error %v", cpus, err)
 	}
 
 	return nil
 }
+
+// Release the CPUs of a container that is never recorded.
+func releaseCpus(containerId string) {
+	if err := cgroups.CpusAllocator.Release(containerId); err != nil {
+		log.Errorf("Release() exclusive CPUs of %s error %v. You may need to delete it from %s manually", containerId, err, cgroups.CpusAllocator.AllocatorPath)
+	}
+}
+
+// Release the name claimed by a container that is never recorded.
+func releaseContainerName(containerName string) {
+	containerInfo := &container.ContainerInfo{Name: containerName}
+	if err := containerInfo.Remove(); err != nil {
+		log.Errorf("Remove() info of %s error %v. You may need to delete it manually", containerName, err)
+	}
+}
+
+// Parse device rate limits of the form path:rate, like /dev/sda:1mb.
+// The rate is a byte size if isBytes, or else a number of IO.
+func parseThrottleDevices(specs []string, isBytes bool) ([]cgroups.ThrottleDevice, error) {
+	var devices []cgroups.ThrottleDevice
+	for _, spec := range specs {
+		idx := strings.LastIndex(spec, ":")
+		if idx <= 0 {
+			return nil, fmt.Errorf("Invalid device rate %s", spec)
+		}
+		devicePath, rateStr := spec[:idx], spec[idx+1:]
+
+		var rate uint64
+		if isBytes {
+			size, err := util.ParseByteSize(rateStr)
+			if err != nil {
+				return nil, fmt.Errorf("ParseByteSize() %s error %v", rateStr, err)
+			}
+			rate = uint64(size)
+		} else {
+			iops, err := strconv.ParseUint(rateStr, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid IO rate %s", rateStr)
+			}
+			rate = iops
+		}
+
+		major, minor, err := util.GetBlockDeviceNumber(devicePath)
+		if err != nil {
+			return nil, fmt.Errorf("GetBlockDeviceNumber() %s error %v", devicePath, err)
+		}
+		devices = append(devices, cgroups.ThrottleDevice{
+			Major: major,
+			Minor: minor,
+			Rate:  rate,
+		})
+	}
+
+	return devices, nil
+}
+
+// Parse huge page limits of the form pagesize:limit, like 2MB:1g.
+// The page size is normalized to the format of cgroup file names.
+func parseHugetlbLimits(specs []string) ([]cgroups.HugetlbLimit, error) {
+	var limits []cgroups.HugetlbLimit
+	for _, spec := range specs {
+		kv := strings.SplitN(spec, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Invalid hugetlb limit %s", spec)
+		}
+
+		pageSize, err := util.ParseByteSize(kv[0])
+		if err != nil || pageSize <= 0 {
+			return nil, fmt.Errorf("Invalid huge page size %s", kv[0])
+		}
+		limit, err := util.ParseByteSize(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("ParseByteSize() %s error %v", kv[1], err)
+		}
+
+		limits = append(limits, cgroups.HugetlbLimit{
+			PageSize: formatHugePageSize(pageSize),
+			Limit:    uint64(limit),
+		})
+	}
+
+	return limits, nil
+}
+
+// Format a page size like the kernel does, such as 64KB, 2MB and 1GB.
+func formatHugePageSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	i := 0
+	for size >= 1024 && size%1024 == 0 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	return fmt.Sprintf("%d%s", size, units[i])
+}
+
+// Parse a cgroup parent path relative to the root of the hierarchies, like
+// team-a or dicker/team-a.
+// Containers with the same parent share its limitations in aggregate.
+func parseCgroupParent(parent string) (string, error) {
+	if len(parent) == 0 {
+		return DEFAULT_CGROUP_PARENT, nil
+	}
+
+	cleaned := path.Clean(strings.TrimPrefix(parent, "/"))
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("Invalid cgroup parent %s", parent)
+	}
+
+	return cleaned, nil
+}
+
+// Parse labels of the form key=value into a map.
+// A label without '=' gets an empty value.
+func parseLabels(labels []string) (map[string]string, error) {
+	labelMap := map[string]string{}
+	for _, label := range labels {
+		if len(strings.TrimSpace(label)) == 0 {
+			continue
+		}
+		kv := strings.SplitN(label, "=", 2)
+		if len(kv[0]) == 0 {
+			return nil, fmt.Errorf("Invalid label %s", label)
+		}
+		if len(kv) == 1 {
+			labelMap[kv[0]] = ""
+		} else {
+			labelMap[kv[0]] = kv[1]
+		}
+	}
+
+	return labelMap, nil
+}
@@ -0,0 +1,128 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chengzeyi/dicker/cgroups"
+)
+
+func Test_parseHugetlbLimits(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []cgroups.HugetlbLimit
+		wantErr bool
+	}{
+		{spec: "2MB:1g", want: []cgroups.HugetlbLimit{{PageSize: "2MB", Limit: 1 << 30}}},
+		{spec: "2m:512m", want: []cgroups.HugetlbLimit{{PageSize: "2MB", Limit: 512 << 20}}},
+		{spec: "1GB:2g", want: []cgroups.HugetlbLimit{{PageSize: "1GB", Limit: 2 << 30}}},
+		{spec: "64kb:1m", want: []cgroups.HugetlbLimit{{PageSize: "64KB", Limit: 1 << 20}}},
+		{spec: "2MB", wantErr: true},
+		{spec: "0:1g", wantErr: true},
+		{spec: "2MB:x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseHugetlbLimits([]string{tt.spec})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseHugetlbLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseHugetlbLimits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseResourceConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		option  RunOption
+		want    cgroups.ResourceConfig
+		wantErr bool
+	}{
+		{
+			name:   "cpus",
+			option: RunOption{Cpus: "1.5"},
+			want:   cgroups.ResourceConfig{CpuPeriod: "100000", CpuQuota: "150000"},
+		},
+		{
+			name:   "cpu period and quota",
+			option: RunOption{CpuPeriod: "50000", CpuQuota: "25000"},
+			want:   cgroups.ResourceConfig{CpuPeriod: "50000", CpuQuota: "25000"},
+		},
+		{
+			name:    "cpus conflicts with quota",
+			option:  RunOption{Cpus: "1", CpuQuota: "25000"},
+			wantErr: true,
+		},
+		{
+			name:   "memory swap",
+			option: RunOption{Memory: "64m", MemorySwap: "128m", MemoryReservation: "32m"},
+			want:   cgroups.ResourceConfig{MemoryLimit: "67108864", MemorySwap: "134217728", MemoryReservation: "33554432"},
+		},
+		{
+			name:   "unlimited memory swap",
+			option: RunOption{Memory: "64m", MemorySwap: "-1"},
+			want:   cgroups.ResourceConfig{MemoryLimit: "67108864", MemorySwap: "-1"},
+		},
+		{
+			name:    "memory swap without memory",
+			option:  RunOption{MemorySwap: "128m"},
+			wantErr: true,
+		},
+		{
+			name:    "memory swap less than memory",
+			option:  RunOption{Memory: "64m", MemorySwap: "32m"},
+			wantErr: true,
+		},
+		{
+			name:   "pids limit",
+			option: RunOption{PidsLimit: "100"},
+			want:   cgroups.ResourceConfig{PidsLimit: "100"},
+		},
+		{
+			name:    "invalid pids limit",
+			option:  RunOption{PidsLimit: "many"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseResourceConfig(&tt.option)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseResourceConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("parseResourceConfig() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseCgroupParent(t *testing.T) {
+	tests := []struct {
+		parent  string
+		want    string
+		wantErr bool
+	}{
+		{parent: "", want: DEFAULT_CGROUP_PARENT},
+		{parent: "team-a", want: "team-a"},
+		{parent: "/dicker/team-a/", want: "dicker/team-a"},
+		{parent: "dicker/../team-a", want: "team-a"},
+		{parent: "/", wantErr: true},
+		{parent: "..", wantErr: true},
+		{parent: "../escape", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.parent, func(t *testing.T) {
+			got, err := parseCgroupParent(tt.parent)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCgroupParent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseCgroupParent() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/chengzeyi/dicker/container"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Written by the shim to the ready pipe once the container is started.
+// Anything else written is the error message.
+const SHIM_READY = "ready"
+
+// Start a shim process supervising the detached container containerName, and
+// wait until it reports whether the container is started.
+// The shim runs in its own session and is reparented to init after this
+// process exits, so it outlives the dicker command.
+func startShim(containerName string) error {
+	selfCmd, err := os.Readlink("/proc/self/exe")
+	if err != nil {
+		return fmt.Errorf("Readlink() /proc/self/exe error %v", err)
+	}
+
+	rReady, wReady, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("Pipe() error %v", err)
+	}
+	defer rReady.Close()
+
+	shimLogFilePath := filepath.Join(container.DEFAULT_INFO_DIR_PATH, containerName, container.SHIM_LOG_FILE_NAME)
+	shimLogFile, err := os.OpenFile(shimLogFilePath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		wReady.Close()
+		return fmt.Errorf("OpenFile() %s error %v", shimLogFilePath, err)
+	}
+	defer shimLogFile.Close()
+
+	shimCmd := exec.Command(selfCmd, COMMAND_SHIM, containerName)
+	shimCmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid: true,
+	}
+	shimCmd.Stdout = shimLogFile
+	shimCmd.Stderr = shimLogFile
+	shimCmd.ExtraFiles = []*os.File{
+		wReady,
+	}
+	if err := shimCmd.Start(); err != nil {
+		wReady.Close()
+		return fmt.Errorf("Start() shim process error %v", err)
+	}
+	// Only the shim holds the write end now, so reading gets EOF when the
+	// shim closes it or exits.
+	wReady.Close()
+
+	msg, err := ioutil.ReadAll(rReady)
+	if err != nil {
+		return fmt.Errorf("ReadAll() ready pipe error %v", err)
+	}
+	if string(msg) != SHIM_READY {
+		if len(msg) == 0 {
+			return fmt.Errorf("Shim exits before the container is started, see %s", shimLogFilePath)
+		}
+		return fmt.Errorf("Shim start container error %s", msg)
+	}
+
+	// Nobody waits for the shim.
+	if err := shimCmd.Process.Release(); err != nil {
+		return fmt.Errorf("Release() shim process error %v", err)
+	}
+
+	return nil
+}
+
+// Start the container, report to the ready pipe on fd 3, and then wait for
+// the container and record how it exits. The workspace and the cgroup are
+// cleaned up after the final exit, like in the tty mode.
+func RunShim(containerName string) error {
+	ready := os.NewFile(3, "ready")
+
+	containerInfo, unlock, err := container.LoadContainerInfoLocked(containerName)
+	if err != nil {
+		err = fmt.Errorf("LoadContainerInfoLocked() %s error %v", containerName, err)
+		ready.WriteString(err.Error())
+		ready.Close()
+		return err
+	}
+
+	parent, err := startContainer(containerInfo, false)
+	unlock()
+	if err != nil {
+		err = fmt.Errorf("startContainer() %s error %v", containerName, err)
+		ready.WriteString(err.Error())
+		ready.Close()
+		return err
+	}
+	if _, err := ready.WriteString(SHIM_READY); err != nil {
+		log.Errorf("WriteString() to ready pipe error %v", err)
+	}
+	ready.Close()
+
+	var backoff time.Duration
+	for {
+		startTime := time.Now()
+		// The process is nil if the restart fails.
+		if parent != nil {
+			if err := waitContainer(parent, containerInfo); err != nil {
+				return fmt.Errorf("waitContainer() %s error %v", containerName, err)
+			}
+			log.Infof("Container %s exits with code %d", containerName, containerInfo.ExitCode)
+		}
+		if !shouldRestart(containerInfo) {
+			break
+		}
+
+		backoff = nextRestartBackoff(backoff, time.Since(startTime))
+		// The container may have been stopped or removed meanwhile.
+		containerInfo, unlock, err = container.LoadContainerInfoLocked(containerName)
+		if err != nil {
+			return fmt.Errorf("LoadContainerInfoLocked() %s error %v", containerName, err)
+		}
+		if containerInfo.ManuallyStopped {
+			unlock()
+			break
+		}
+		containerInfo.Status = container.STATUS_RESTARTING
+		err = containerInfo.Dump()
+		unlock()
+		if err != nil {
+			return fmt.Errorf("Dump() %v error %v", containerInfo, err)
+		}
+		log.Infof("Restart container %s in %v", containerName, backoff)
+		time.Sleep(backoff)
+
+		// Hold the lock until the new process is recorded, so that stop
+		// either prevents the restart or stops the new process.
+		containerInfo, unlock, err = container.LoadContainerInfoLocked(containerName)
+		if err != nil {
+			return fmt.Errorf("LoadContainerInfoLocked() %s error %v", containerName, err)
+		}
+		if containerInfo.ManuallyStopped {
+			unlock()
+			break
+		}
+
+		// Restart in the same workspace.
+		containerInfo.RestartCount++
+		parent, err = startContainer(containerInfo, false)
+		if err != nil {
+			// Record the failure like an exit, so that the restart policy
+			// decides whether to retry.
+			log.Errorf("startContainer() %s error %v", containerName, err)
+			containerInfo.Status = container.STATUS_EXITED
+			containerInfo.ExitCode = START_FAILURE_EXIT_CODE
+			containerInfo.FinishTime = time.Now().Format("2006-01-02 15:04:05")
+			containerInfo.Error = err.Error()
+			if err := containerInfo.Dump(); err != nil {
+				unlock()
+				return fmt.Errorf("Dump() %v error %v", containerInfo, err)
+			}
+		}
+		unlock()
+	}
+	cleanupContainer(containerInfo)
+
+	return nil
+}
@@ -0,0 +1,315 @@
+package command
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chengzeyi/dicker/cgroups"
+	"github.com/chengzeyi/dicker/container"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	STATS_INTERVAL = time.Second
+
+	STATS_FORMAT_TABLE = "table"
+	STATS_FORMAT_JSON  = "json"
+)
+
+type StatsOption struct {
+	NoStream bool
+	Format   string
+}
+
+type containerStats struct {
+	Id            string  `json:"id"`
+	Name          string  `json:"name"`
+	CpuPercent    float64 `json:"cpu_percent"`
+	MemoryUsage   uint64  `json:"memory_usage"`
+	MemoryLimit   uint64  `json:"memory_limit"`
+	MemoryPercent float64 `json:"memory_percent"`
+	NetRx         uint64  `json:"net_rx"`
+	NetTx         uint64  `json:"net_tx"`
+	BlockRead     uint64  `json:"block_read"`
+	BlockWrite    uint64  `json:"block_write"`
+	Pids          uint64  `json:"pids"`
+
+	CpuPressure    *cgroups.Pressure `json:"cpu_pressure,omitempty"`
+	MemoryPressure *cgroups.Pressure `json:"memory_pressure,omitempty"`
+	IoPressure     *cgroups.Pressure `json:"io_pressure,omitempty"`
+}
+
+// The CPU percentage is computed between two samples.
+type cpuSample struct {
+	usage uint64
+	time  time.Time
+}
+
+// Print the resource usage of containers every STATS_INTERVAL.
+// All the running containers are shown if containerNames is empty.
+func Stats(option *StatsOption, containerNames []string) error {
+	switch option.Format {
+	case STATS_FORMAT_TABLE, STATS_FORMAT_JSON:
+	default:
+		return fmt.Errorf("Unknown format %s", option.Format)
+	}
+
+	samples := map[string]cpuSample{}
+	for first := true; ; first = false {
+		containerInfos, err := listStatsContainers(containerNames)
+		if err != nil {
+			return fmt.Errorf("listStatsContainers() %v error %v", containerNames, err)
+		}
+
+		var statsList []*containerStats
+		for _, containerInfo := range containerInfos {
+			stats, err := collectContainerStats(containerInfo, samples)
+			if err != nil {
+				log.Warnf("collectContainerStats() %s error %v", containerInfo.Name, err)
+				stats = &containerStats{Id: containerInfo.Id, Name: containerInfo.Name}
+			}
+			statsList = append(statsList, stats)
+		}
+
+		// There is no CPU percentage until the second sample.
+		if !first {
+			if err := printStats(option, statsList); err != nil {
+				return fmt.Errorf("printStats() error %v", err)
+			}
+			if option.NoStream {
+				return nil
+			}
+		}
+
+		time.Sleep(STATS_INTERVAL)
+	}
+}
+
+func listStatsContainers(containerNames []string) ([]*container.ContainerInfo, error) {
+	if len(containerNames) != 0 {
+		var containerInfos []*container.ContainerInfo
+		for _, containerName := range containerNames {
+			containerInfo, err := container.LoadContainerInfo(containerName)
+			if err != nil {
+				return nil, fmt.Errorf("LoadContainerInfo() %s error %v", containerName, err)
+			}
+			containerInfo.RefreshStatus()
+			containerInfos = append(containerInfos, containerInfo)
+		}
+		return containerInfos, nil
+	}
+
+	allContainerInfos, err := container.ListContainerInfos()
+	if err != nil {
+		return nil, fmt.Errorf("ListContainerInfos() error %v", err)
+	}
+	var containerInfos []*container.ContainerInfo
+	for _, containerInfo := range allContainerInfos {
+		containerInfo.RefreshStatus()
+		if containerInfo.Status == container.STATUS_RUNNING || containerInfo.Status == container.STATUS_PAUSED {
+			containerInfos = append(containerInfos, containerInfo)
+		}
+	}
+
+	return containerInfos, nil
+}
+
+// A container not running has zero usage.
+func collectContainerStats(containerInfo *container.ContainerInfo, samples map[string]cpuSample) (*containerStats, error) {
+	stats := &containerStats{
+		Id:   containerInfo.Id,
+		Name: containerInfo.Name,
+	}
+	if (containerInfo.Status != container.STATUS_RUNNING && containerInfo.Status != container.STATUS_PAUSED) || len(containerInfo.CgroupPath) == 0 {
+		delete(samples, containerInfo.Id)
+		return stats, nil
+	}
+
+	cgroupStats, err := cgroups.NewCgroupManager(containerInfo.CgroupPath).GetStats()
+	if err != nil {
+		return nil, fmt.Errorf("GetStats() cgroup %s error %v", containerInfo.CgroupPath, err)
+	}
+
+	now := time.Now()
+	if prev, ok := samples[containerInfo.Id]; ok && cgroupStats.CpuUsage >= prev.usage {
+		stats.CpuPercent = float64(cgroupStats.CpuUsage-prev.usage) / float64(now.Sub(prev.time).Nanoseconds()) * 100
+	}
+	samples[containerInfo.Id] = cpuSample{usage: cgroupStats.CpuUsage, time: now}
+
+	stats.MemoryUsage = cgroupStats.MemoryUsage
+	stats.MemoryLimit = cgroupStats.MemoryLimit
+	// Unlimited memory is limited by the host.
+	if stats.MemoryLimit == 0 {
+		if stats.MemoryLimit, err = getHostMemory(); err != nil {
+			return nil, fmt.Errorf("getHostMemory() error %v", err)
+		}
+	}
+	if stats.MemoryLimit != 0 {
+		stats.MemoryPercent = float64(stats.MemoryUsage) / float64(stats.MemoryLimit) * 100
+	}
+	stats.BlockRead = cgroupStats.BlkioRead
+	stats.BlockWrite = cgroupStats.BlkioWrite
+	stats.Pids = cgroupStats.PidsCurrent
+	stats.CpuPressure = cgroupStats.CpuPressure
+	stats.MemoryPressure = cgroupStats.MemoryPressure
+	stats.IoPressure = cgroupStats.IoPressure
+
+	// The file shows the interfaces of the network namespace of the process.
+	netDevFilePath := filepath.Join("/proc", strconv.Itoa(containerInfo.Pid), "net", "dev")
+	f, err := os.Open(netDevFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("Open() %s error %v", netDevFilePath, err)
+	}
+	defer f.Close()
+	if stats.NetRx, stats.NetTx, err = parseNetDev(f); err != nil {
+		return nil, fmt.Errorf("parseNetDev() %s error %v", netDevFilePath, err)
+	}
+
+	return stats, nil
+}
+
+// Sum the received and transmitted bytes of all the interfaces except lo.
+func parseNetDev(reader io.Reader) (uint64, uint64, error) {
+	var rx, tx uint64
+
+	// The content is like:
+	// Inter-|   Receive                                                |  Transmit
+	//  face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+	//   eth0:    1296      16    0    0    0     0          0         0      936      12    0    0    0     0       0          0
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if strings.TrimSpace(kv[0]) == "lo" {
+			continue
+		}
+		fields := strings.Fields(kv[1])
+		if len(fields) < 9 {
+			return 0, 0, fmt.Errorf("Invalid line %s", scanner.Text())
+		}
+		rxBytes, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("ParseUint() %s error %v", fields[0], err)
+		}
+		txBytes, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("ParseUint() %s error %v", fields[8], err)
+		}
+		rx += rxBytes
+		tx += txBytes
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, 0, fmt.Errorf("Scan() error %v", err)
+	}
+
+	return rx, tx, nil
+}
+
+// Read MemTotal in /proc/meminfo.
+func getHostMemory() (uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, fmt.Errorf("Open() /proc/meminfo error %v", err)
+	}
+	defer f.Close()
+
+	// The line is like:
+	// MemTotal:       16310124 kB
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "MemTotal:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("ParseUint() %s error %v", fields[1], err)
+			}
+			return kb << 10, nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("Scan() /proc/meminfo error %v", err)
+	}
+
+	return 0, fmt.Errorf("Cannot find MemTotal in /proc/meminfo")
+}
+
+func printStats(option *StatsOption, statsList []*containerStats) error {
+	if option.Format == STATS_FORMAT_JSON {
+		for _, stats := range statsList {
+			jsonBytes, err := json.Marshal(stats)
+			if err != nil {
+				return fmt.Errorf("Marshal() %v error %v", stats, err)
+			}
+			fmt.Fprintln(os.Stdout, string(jsonBytes))
+		}
+		return nil
+	}
+
+	// Refresh the whole screen like top.
+	if !option.NoStream {
+		fmt.Fprint(os.Stdout, "\033[2J\033[H")
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	fmt.Fprint(writer, "CONTAINER_ID\tNAME\tCPU%\tMEM_USAGE/LIMIT\tMEM%\tNET_I/O\tBLOCK_I/O\tPIDS\tCPU_PSI\tMEM_PSI\tIO_PSI\n")
+	for _, stats := range statsList {
+		fmt.Fprintf(writer, "%s\t%s\t%.2f%%\t%s/%s\t%.2f%%\t%s/%s\t%s/%s\t%d\t%s\t%s\t%s\n",
+			stats.Id,
+			stats.Name,
+			stats.CpuPercent,
+			formatByteSize(stats.MemoryUsage),
+			formatByteSize(stats.MemoryLimit),
+			stats.MemoryPercent,
+			formatByteSize(stats.NetRx),
+			formatByteSize(stats.NetTx),
+			formatByteSize(stats.BlockRead),
+			formatByteSize(stats.BlockWrite),
+			stats.Pids,
+			formatPressure(stats.CpuPressure),
+			formatPressure(stats.MemoryPressure),
+			formatPressure(stats.IoPressure))
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("Flush() error %v", err)
+	}
+
+	return nil
+}
+
+// Show the avg10, the avg60 and the total stall time of some pressure, like
+// 1.50%/0.25%/1.234s. The json format has the full values.
+func formatPressure(pressure *cgroups.Pressure) string {
+	if pressure == nil {
+		return "-"
+	}
+	total := (time.Duration(pressure.Some.Total) * time.Microsecond).Round(time.Millisecond)
+	return fmt.Sprintf("%.2f%%/%.2f%%/%v", pressure.Some.Avg10, pressure.Some.Avg60, total)
+}
+
+// Format a size in bytes like 1.5MiB.
+func formatByteSize(size uint64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	val := float64(size)
+	i := 0
+	for val >= 1024 && i < len(units)-1 {
+		val /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d%s", size, units[i])
+	}
+	return fmt.Sprintf("%.2f%s", val, units[i])
+}
@@ -0,0 +1,56 @@
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/chengzeyi/dicker/cgroups"
+)
+
+func Test_parseNetDev(t *testing.T) {
+	netDev := `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:     500       5    0    0    0     0          0         0      500       5    0    0    0     0       0          0
+  eth0:    1296      16    0    0    0     0          0         0      936      12    0    0    0     0       0          0
+  eth1:     104       2    0    0    0     0          0         0       64       1    0    0    0     0       0          0
+`
+	rx, tx, err := parseNetDev(strings.NewReader(netDev))
+	if err != nil {
+		t.Fatalf("parseNetDev() error = %v", err)
+	}
+	if rx != 1400 || tx != 1000 {
+		t.Errorf("parseNetDev() = %d, %d, want 1400, 1000", rx, tx)
+	}
+}
+
+func Test_formatByteSize(t *testing.T) {
+	tests := []struct {
+		size uint64
+		want string
+	}{
+		{size: 0, want: "0B"},
+		{size: 1023, want: "1023B"},
+		{size: 1536, want: "1.50KiB"},
+		{size: 64 << 20, want: "64.00MiB"},
+		{size: 3 << 29, want: "1.50GiB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := formatByteSize(tt.size); got != tt.want {
+				t.Errorf("formatByteSize() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_formatPressure(t *testing.T) {
+	if got := formatPressure(nil); got != "-" {
+		t.Errorf("formatPressure() = %s, want -", got)
+	}
+	pressure := &cgroups.Pressure{
+		Some: cgroups.PressureValues{Avg10: 1.5, Avg60: 0.25, Total: 1234567},
+	}
+	if got := formatPressure(pressure); got != "1.50%/0.25%/1.235s" {
+		t.Errorf("formatPressure() = %s, want 1.50%%/0.25%%/1.235s", got)
+	}
+}
@@ -1,5 +1,200 @@
 package command
 
-func Stop(containerName string) {
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/chengzeyi/dicker/cgroups"
+	"github.com/chengzeyi/dicker/container"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const STOP_POLL_INTERVAL = 100 * time.Millisecond
+
+type StopOption struct {
+	Timeout time.Duration
+	Signal  string
+}
+
+var signalMap = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"TERM": syscall.SIGTERM,
+}
+
+// Stop the containers in parallel.
+// The returned error is the last occurred error.
+func Stop(option *StopOption, containerNames []string) error {
+	sig, err := parseSignal(option.Signal)
+	if err != nil {
+		return fmt.Errorf("parseSignal() %s error %v", option.Signal, err)
+	}
+
+	var retErr error
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, containerName := range containerNames {
+		wg.Add(1)
+		go func(containerName string) {
+			defer wg.Done()
+			if err := stopContainer(containerName, sig, option.Timeout); err != nil {
+				log.Errorf("stopContainer() %s error %v", containerName, err)
+				mutex.Lock()
+				retErr = fmt.Errorf("stopContainer() %s error %v", containerName, err)
+				mutex.Unlock()
+			}
+		}(containerName)
+	}
+	wg.Wait()
+
+	return retErr
+}
+
+// Send sig to the container init process and wait for at most timeout
+// before escalating to SIGKILL.
+func stopContainer(containerName string, sig syscall.Signal, timeout time.Duration) error {
+	// The shim cannot restart the container until the flag is recorded.
+	containerInfo, unlock, err := container.LoadContainerInfoLocked(containerName)
+	if err != nil {
+		return fmt.Errorf("LoadContainerInfoLocked() %s error %v", containerName, err)
+	}
+	pid := containerInfo.Pid
+
+	if !container.IsProcessAlive(pid) {
+		if containerInfo.Status == container.STATUS_RESTARTING {
+			// Prevent the shim from restarting it.
+			containerInfo.ManuallyStopped = true
+			containerInfo.Status = container.STATUS_STOPPED
+		} else {
+			// Nothing to stop, just correct the recorded status.
+			log.Warnf("Container %s is not running", containerName)
+			containerInfo.RefreshStatus()
+		}
+		err := containerInfo.Dump()
+		unlock()
+		if err != nil {
+			return fmt.Errorf("Dump() %v error %v", containerInfo, err)
+		}
+		return nil
+	}
+
+	// Tell the shim that the container exits because of this command.
+	containerInfo.ManuallyStopped = true
+	err = containerInfo.Dump()
+	unlock()
+	if err != nil {
+		return fmt.Errorf("Dump() %v error %v", containerInfo, err)
+	}
+
+	// Conventionally a process killed by a signal exits with 128 + signal.
+	exitCode := 128 + int(sig)
+	if err := syscall.Kill(pid, sig); err != nil && err != syscall.ESRCH {
+		return fmt.Errorf("Kill() pid %d with signal %v error %v", pid, sig, err)
+	}
+	// A frozen process only handles the signal after it is thawed.
+	if containerInfo.Status == container.STATUS_PAUSED {
+		if err := cgroups.NewCgroupManager(containerInfo.CgroupPath).Thaw(); err != nil {
+			return fmt.Errorf("Thaw() cgroup %s error %v", containerInfo.CgroupPath, err)
+		}
+	}
+	if !waitProcessExit(pid, timeout) {
+		log.Warnf("Container %s does not exit within %v, kill it", containerName, timeout)
+		exitCode = 128 + int(syscall.SIGKILL)
+		if err := killContainerProcesses(containerInfo, syscall.SIGKILL); err != nil {
+			return fmt.Errorf("killContainerProcesses() %s error %v", containerName, err)
+		}
+		if !waitProcessExit(pid, timeout) {
+			return fmt.Errorf("Container %s still alive after SIGKILL", containerName)
+		}
+	}
+	// Daemonized processes and processes joined by exec may survive the
+	// init process.
+	if err := killContainerProcesses(containerInfo, syscall.SIGKILL); err != nil {
+		log.Warnf("killContainerProcesses() %s error %v", containerName, err)
+	}
+
+	// Reload since the shim may have recorded the real exit code meanwhile.
+	containerInfo, unlock, err = container.LoadContainerInfoLocked(containerName)
+	if err != nil {
+		return fmt.Errorf("LoadContainerInfoLocked() %s error %v", containerName, err)
+	}
+	defer unlock()
+	if containerInfo.Status == container.STATUS_STOPPED || containerInfo.Status == container.STATUS_EXITED {
+		exitCode = containerInfo.ExitCode
+	}
+	containerInfo.Status = container.STATUS_STOPPED
+	containerInfo.ExitCode = exitCode
+	if len(containerInfo.FinishTime) == 0 {
+		containerInfo.FinishTime = time.Now().Format("2006-01-02 15:04:05")
+	}
+	if err := containerInfo.Dump(); err != nil {
+		return fmt.Errorf("Dump() %v error %v", containerInfo, err)
+	}
+
+	return nil
+}
+
+// Send sig to every process in the container cgroup, or only the init process
+// if the container has no cgroup.
+func killContainerProcesses(containerInfo *container.ContainerInfo, sig syscall.Signal) error {
+	if len(containerInfo.CgroupPath) == 0 {
+		if err := syscall.Kill(containerInfo.Pid, sig); err != nil && err != syscall.ESRCH {
+			return fmt.Errorf("Kill() pid %d with signal %v error %v", containerInfo.Pid, sig, err)
+		}
+		return nil
+	}
+
+	// The shim removes the cgroup once the container exits for the last time.
+	cgroupManager := cgroups.NewCgroupManager(containerInfo.CgroupPath)
+	pids, err := cgroupManager.GetPids()
+	if err != nil {
+		return fmt.Errorf("GetPids() cgroup %s error %v", containerInfo.CgroupPath, err)
+	}
+	if len(pids) == 0 {
+		return nil
+	}
+	if err := cgroupManager.Kill(sig); err != nil {
+		return fmt.Errorf("Kill() cgroup %s with signal %v error %v", containerInfo.CgroupPath, sig, err)
+	}
+
+	return nil
+}
+
+// Return whether the process exits within timeout.
+func waitProcessExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for container.IsProcessAlive(pid) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(STOP_POLL_INTERVAL)
+	}
+
+	return true
+}
+
+// Parse a signal name like SIGTERM, TERM or a signal number like 15.
+func parseSignal(sigStr string) (syscall.Signal, error) {
+	if num, err := strconv.Atoi(sigStr); err == nil {
+		if num <= 0 || num > 64 {
+			return 0, fmt.Errorf("Invalid signal number %d", num)
+		}
+		return syscall.Signal(num), nil
+	}
+
+	sig, ok := signalMap[strings.TrimPrefix(strings.ToUpper(sigStr), "SIG")]
+	if !ok {
+		return 0, fmt.Errorf("Unknown signal %s", sigStr)
+	}
+
+	return sig, nil
 }
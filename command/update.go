@@ -0,0 +1,154 @@
+package command
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/chengzeyi/dicker/cgroups"
+	"github.com/chengzeyi/dicker/container"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type UpdateOption struct {
+	Memory       string
+	CpuShares    string
+	Cpus         string
+	CpusetCpus   string
+	PidsLimit    string
+	CgroupParent string
+}
+
+// Update the resource limitations of containers one by one, or of the cgroup
+// parent if option.CgroupParent is given.
+// The returned error is the last occurred error.
+func Update(option *UpdateOption, containerNames []string) error {
+	// Validate the same way as run.
+	res, err := parseResourceConfig(&RunOption{
+		Memory:     option.Memory,
+		CpuShares:  option.CpuShares,
+		Cpus:       option.Cpus,
+		CpusetCpus: option.CpusetCpus,
+		PidsLimit:  option.PidsLimit,
+	})
+	if err != nil {
+		return fmt.Errorf("parseResourceConfig() error %v", err)
+	}
+	if reflect.DeepEqual(*res, cgroups.ResourceConfig{}) {
+		return fmt.Errorf("Nothing to update")
+	}
+
+	if len(option.CgroupParent) != 0 {
+		if len(containerNames) != 0 {
+			return fmt.Errorf("Cannot update containers and cgroup parent %s together", option.CgroupParent)
+		}
+		cgroupParent, err := parseCgroupParent(option.CgroupParent)
+		if err != nil {
+			return fmt.Errorf("parseCgroupParent() %s error %v", option.CgroupParent, err)
+		}
+		if err := cgroups.NewCgroupManager(cgroupParent).Set(res); err != nil {
+			return fmt.Errorf("Set() cgroup %s error %v", cgroupParent, err)
+		}
+		return nil
+	}
+
+	var retErr error
+	for _, containerName := range containerNames {
+		if err := updateContainer(containerName, res); err != nil {
+			retErr = fmt.Errorf("updateContainer() %s error %v", containerName, err)
+			log.Error(retErr.Error())
+		}
+	}
+
+	return retErr
+}
+
+// Only the non-empty limitations in res are changed.
+// They are applied one by one and those accepted by the kernel are saved,
+// even if a later one is refused.
+func updateContainer(containerName string, res *cgroups.ResourceConfig) error {
+	containerInfo, unlock, err := container.LoadContainerInfoLocked(containerName)
+	if err != nil {
+		return fmt.Errorf("LoadContainerInfoLocked() %s error %v", containerName, err)
+	}
+	defer unlock()
+	if len(containerInfo.CgroupPath) == 0 {
+		return fmt.Errorf("Container %s has no cgroup", containerName)
+	}
+	if len(res.Cpuset) != 0 {
+		exclusiveCpus, err := cgroups.CpusAllocator.Allocated(containerInfo.Id)
+		if err != nil {
+			return fmt.Errorf("Allocated() exclusive CPUs of %s error %v", containerInfo.Id, err)
+		}
+		if len(exclusiveCpus) != 0 {
+			return fmt.Errorf("Container %s has exclusive CPUs %s", containerName, cgroups.FormatCpuList(exclusiveCpus))
+		}
+		if err := shareCpus(containerInfo.Id, res.Cpuset); err != nil {
+			return fmt.Errorf("shareCpus() %s error %v", res.Cpuset, err)
+		}
+	}
+
+	if containerInfo.Resources == nil {
+		containerInfo.Resources = &cgroups.ResourceConfig{}
+	}
+	oldCpuset := containerInfo.Resources.Cpuset
+	// The period and the quota make up one limitation.
+	// The saved memory plus swap limit is written again with the memory
+	// limit, so that they are written in the right order on v1 and the swap
+	// limit on v2 follows the memory limit. A memory limit above it is
+	// refused.
+	var memorySwap string
+	if len(res.MemoryLimit) != 0 {
+		memorySwap = containerInfo.Resources.MemorySwap
+	}
+	updates := []*cgroups.ResourceConfig{
+		{MemoryLimit: res.MemoryLimit, MemorySwap: memorySwap},
+		{CpuShares: res.CpuShares},
+		{CpuPeriod: res.CpuPeriod, CpuQuota: res.CpuQuota},
+		{Cpuset: res.Cpuset},
+		{PidsLimit: res.PidsLimit},
+	}
+	cgroupManager := cgroups.NewCgroupManager(containerInfo.CgroupPath)
+	var setErr error
+	for _, update := range updates {
+		if reflect.DeepEqual(*update, cgroups.ResourceConfig{}) {
+			continue
+		}
+		if err := cgroupManager.Set(update); err != nil {
+			setErr = fmt.Errorf("Set() cgroup %s error %v", containerInfo.CgroupPath, err)
+			break
+		}
+		mergeResourceConfig(containerInfo.Resources, update)
+	}
+	// The CPUs are still used by the container if the cpuset is refused.
+	if len(res.Cpuset) != 0 && containerInfo.Resources.Cpuset != res.Cpuset {
+		if err := shareCpus(containerInfo.Id, oldCpuset); err != nil {
+			log.Errorf("shareCpus() %s error %v", oldCpuset, err)
+		}
+	}
+
+	if err := containerInfo.Dump(); err != nil {
+		return fmt.Errorf("Dump() %v error %v", containerInfo, err)
+	}
+
+	return setErr
+}
+
+// Override the limitations in dst with the non-empty ones in src.
+func mergeResourceConfig(dst, src *cgroups.ResourceConfig) {
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&dst.MemoryLimit, src.MemoryLimit},
+		{&dst.CpuShares, src.CpuShares},
+		{&dst.CpuPeriod, src.CpuPeriod},
+		{&dst.CpuQuota, src.CpuQuota},
+		{&dst.Cpuset, src.Cpuset},
+		{&dst.PidsLimit, src.PidsLimit},
+	} {
+		if len(field.src) != 0 {
+			*field.dst = field.src
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chengzeyi/dicker/cgroups"
+)
+
+func Test_mergeResourceConfig(t *testing.T) {
+	dst := &cgroups.ResourceConfig{
+		MemoryLimit: "67108864",
+		CpuShares:   "512",
+		Cpuset:      "0",
+	}
+	mergeResourceConfig(dst, &cgroups.ResourceConfig{
+		MemoryLimit: "134217728",
+		CpuPeriod:   "100000",
+		CpuQuota:    "50000",
+	})
+
+	want := cgroups.ResourceConfig{
+		MemoryLimit: "134217728",
+		CpuShares:   "512",
+		CpuPeriod:   "100000",
+		CpuQuota:    "50000",
+		Cpuset:      "0",
+	}
+	if !reflect.DeepEqual(*dst, want) {
+		t.Errorf("mergeResourceConfig() = %+v, want %+v", *dst, want)
+	}
+}
@@ -0,0 +1,255 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/chengzeyi/dicker/container"
+	"github.com/chengzeyi/dicker/util"
+	"github.com/chengzeyi/dicker/volume"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type VolumeCreateOption struct {
+	Driver  string
+	Options []string
+	Labels  []string
+}
+
+type VolumeLsOption struct {
+	Quiet bool
+}
+
+// Create a named volume and print its name.
+func VolumeCreate(option *VolumeCreateOption, volumeName string) error {
+	volumeOptions, err := parseVolumeOptions(option.Options)
+	if err != nil {
+		return fmt.Errorf("parseVolumeOptions() %v error %v", option.Options, err)
+	}
+	labelMap, err := parseLabels(option.Labels)
+	if err != nil {
+		return fmt.Errorf("parseLabels() %v error %v", option.Labels, err)
+	}
+
+	v, err := volume.CreateVolume(volumeName, option.Driver, volumeOptions, labelMap)
+	if err != nil {
+		return fmt.Errorf("CreateVolume() %s error %v", volumeName, err)
+	}
+	fmt.Fprintln(os.Stdout, v.Name)
+
+	return nil
+}
+
+// List the named volumes and the containers using them.
+func VolumeLs(option *VolumeLsOption) error {
+	volumes, err := volume.ListVolumes()
+	if err != nil {
+		return fmt.Errorf("ListVolumes() error %v", err)
+	}
+	names, err := loadContainerNames()
+	if err != nil {
+		return fmt.Errorf("loadContainerNames() error %v", err)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	if !option.Quiet {
+		fmt.Fprint(writer, "NAME\tDRIVER\tMOUNTPOINT\tCREATED\tCONTAINERS\n")
+	}
+	for _, v := range volumes {
+		if option.Quiet {
+			fmt.Fprintf(writer, "%s\n", v.Name)
+		} else {
+			var users []string
+			for _, containerId := range v.InUseBy(names.exists) {
+				users = append(users, names[containerId])
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n",
+				v.Name,
+				v.Driver,
+				v.Mountpoint,
+				v.CreateTime,
+				strings.Join(users, ","))
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("Flush() error %v", err)
+	}
+
+	return nil
+}
+
+// Print the metadata of the volumes as an indented JSON array.
+func VolumeInspect(volumeNames []string) error {
+	var volumes []*volume.Volume
+	for _, volumeName := range volumeNames {
+		v, err := volume.LoadVolume(volumeName)
+		if err != nil {
+			return fmt.Errorf("LoadVolume() %s error %v", volumeName, err)
+		}
+		volumes = append(volumes, v)
+	}
+
+	jsonBytes, err := json.MarshalIndent(volumes, "", "    ")
+	if err != nil {
+		return fmt.Errorf("MarshalIndent() %v error %v", volumes, err)
+	}
+	fmt.Fprintln(os.Stdout, string(jsonBytes))
+
+	return nil
+}
+
+// Remove the volumes one by one.
+// The returned error is the last occurred error.
+func VolumeRm(volumeNames []string) error {
+	names, err := loadContainerNames()
+	if err != nil {
+		return fmt.Errorf("loadContainerNames() error %v", err)
+	}
+
+	var retErr error
+	for _, volumeName := range volumeNames {
+		if err := volume.RemoveVolume(volumeName, names.exists); err != nil {
+			retErr = fmt.Errorf("RemoveVolume() %s error %v", volumeName, err)
+			log.Error(retErr.Error())
+		}
+	}
+
+	return retErr
+}
+
+// Remove every volume not used by any container and print their names.
+func VolumePrune() error {
+	names, err := loadContainerNames()
+	if err != nil {
+		return fmt.Errorf("loadContainerNames() error %v", err)
+	}
+
+	pruned, err := volume.PruneVolumes(names.exists)
+	for _, volumeName := range pruned {
+		fmt.Fprintln(os.Stdout, volumeName)
+	}
+	if err != nil {
+		return fmt.Errorf("PruneVolumes() error %v", err)
+	}
+
+	return nil
+}
+
+// Record the container as a user of every named volume it mounts, creating
+// the volumes on first use, and point the mounts at their data directories.
+// Nothing is acquired if it fails.
+func acquireVolumes(containerId string, mounts []*container.VolumeMount) error {
+	for i, m := range mounts {
+		if len(m.Name) == 0 {
+			continue
+		}
+		v, created, err := volume.AcquireVolume(m.Name, containerId)
+		if err != nil {
+			releaseVolumes(containerId, mounts[:i])
+			return fmt.Errorf("AcquireVolume() %s error %v", m.Name, err)
+		}
+		if created {
+			log.Infof("Volume %s is created at %s", v.Name, v.Mountpoint)
+		}
+		m.Source = v.Mountpoint
+		m.Driver = v.Driver
+		m.Options = v.Options
+	}
+
+	return nil
+}
+
+func releaseVolumes(containerId string, mounts []*container.VolumeMount) {
+	for _, m := range mounts {
+		if len(m.Name) == 0 {
+			continue
+		}
+		if err := volume.ReleaseVolume(m.Name, containerId); err != nil {
+			log.Errorf("ReleaseVolume() %s of %s error %v", m.Name, containerId, err)
+		}
+	}
+}
+
+// Parse driver options of the form key=value.
+// Supported keys are size, like 64m, and mode, an octal number like 1777.
+func parseVolumeOptions(options []string) (container.VolumeOptions, error) {
+	var volumeOptions container.VolumeOptions
+	for _, option := range options {
+		if len(strings.TrimSpace(option)) == 0 {
+			continue
+		}
+		kv := strings.SplitN(option, "=", 2)
+		if len(kv) != 2 {
+			return container.VolumeOptions{}, fmt.Errorf("Invalid volume option %s", option)
+		}
+		switch kv[0] {
+		case "size":
+			size, err := util.ParseByteSize(kv[1])
+			if err != nil {
+				return container.VolumeOptions{}, fmt.Errorf("ParseByteSize() %s error %v", kv[1], err)
+			}
+			volumeOptions.Size = size
+		case "mode":
+			mode, err := strconv.ParseUint(kv[1], 8, 32)
+			if err != nil || mode&^07777 != 0 {
+				return container.VolumeOptions{}, fmt.Errorf("Invalid mode %s", kv[1])
+			}
+			volumeOptions.Mode = uint32(mode)
+		default:
+			return container.VolumeOptions{}, fmt.Errorf("Unknown volume option %s", kv[0])
+		}
+	}
+
+	return volumeOptions, nil
+}
+
+// Parse a tmpfs of the form path[:option[,option]...], like /tmp:size=64m.
+func parseTmpfsMount(spec string) (*container.VolumeMount, error) {
+	fields := strings.SplitN(spec, ":", 2)
+	m := &container.VolumeMount{
+		Destination: filepath.Clean(fields[0]),
+		Propagation: container.PROPAGATION_RPRIVATE,
+		Driver:      container.VOLUME_DRIVER_TMPFS,
+	}
+	if !filepath.IsAbs(fields[0]) || m.Destination == "/" {
+		return nil, fmt.Errorf("Invalid container path %s of tmpfs %s", fields[0], spec)
+	}
+	if len(fields) == 2 {
+		options, err := parseVolumeOptions(strings.Split(fields[1], ","))
+		if err != nil {
+			return nil, fmt.Errorf("parseVolumeOptions() %s error %v", fields[1], err)
+		}
+		m.Options = options
+	}
+
+	return m, nil
+}
+
+// The names of the existing containers keyed by their ids.
+type containerNames map[string]string
+
+func loadContainerNames() (containerNames, error) {
+	containerInfos, err := container.ListContainerInfos()
+	if err != nil {
+		return nil, fmt.Errorf("ListContainerInfos() error %v", err)
+	}
+	names := containerNames{}
+	for _, containerInfo := range containerInfos {
+		names[containerInfo.Id] = containerInfo.Name
+	}
+
+	return names, nil
+}
+
+// References of containers that no longer exist do not keep volumes in use.
+func (names containerNames) exists(containerId string) bool {
+	_, exist := names[containerId]
+	return exist
+}
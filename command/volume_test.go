@@ -0,0 +1,41 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/chengzeyi/dicker/container"
+)
+
+func Test_parseTmpfsMount(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    container.VolumeOptions
+		wantErr bool
+	}{
+		{"/tmp", container.VolumeOptions{}, false},
+		{"/tmp:size=64m", container.VolumeOptions{Size: 64 << 20}, false},
+		{"/tmp:size=1g,mode=1777", container.VolumeOptions{Size: 1 << 30, Mode: 01777}, false},
+		{"/tmp:mode=999", container.VolumeOptions{}, true},
+		{"/tmp:uid=0", container.VolumeOptions{}, true},
+		{"tmp:size=64m", container.VolumeOptions{}, true},
+		{"/", container.VolumeOptions{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseTmpfsMount(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTmpfsMount() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Driver != container.VOLUME_DRIVER_TMPFS || got.Destination != "/tmp" {
+				t.Errorf("parseTmpfsMount() = %+v", got)
+			}
+			if !reflect.DeepEqual(got.Options, tt.want) {
+				t.Errorf("parseTmpfsMount() options = %+v, want %+v", got.Options, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package container
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// AUFS and OCI whiteouts, translated into overlayfs ones.
+	WHITEOUT_PREFIX = ".wh."
+	WHITEOUT_OPAQUE = ".wh..wh..opq"
+	// Set to y on a directory to hide the lower directories in overlayfs.
+	OVERLAY_OPAQUE_XATTR = "trusted.overlay.opaque"
+	// Extended attributes are kept in PAX records with this prefix.
+	PAX_XATTR_PREFIX = "SCHILY.xattr."
+	// Symlinks followed when resolving a path, like the kernel MAXSYMLINKS.
+	MAX_SYMLINKS = 40
+)
+
+// Extract the tar stream, optionally gzip compressed, to the directory root.
+// Every path is resolved as if root were the filesystem root, so entries like
+// ../x or those under absolute symlinks never leave root.
+// Ownership, modes, times, extended attributes, hardlinks, devices and holes
+// of sparse files are kept, and whiteouts become overlayfs whiteouts.
+func ExtractTar(reader io.Reader, root string) error {
+	bufReader := bufio.NewReader(reader)
+	// gzip streams start with 0x1f 0x8b.
+	if magic, err := bufReader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(bufReader)
+		if err != nil {
+			return fmt.Errorf("gzip.NewReader() error %v", err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	} else {
+		reader = bufReader
+	}
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return fmt.Errorf("MkdirAll() %s error %v", root, err)
+	}
+
+	// The times of directories are set last, since extracting their children
+	// changes them.
+	var dirHeaders []*tar.Header
+	var dirPaths []string
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Next() tar header error %v", err)
+		}
+
+		path, err := extractTarEntry(tarReader, header, root)
+		if err != nil {
+			return fmt.Errorf("extractTarEntry() %s error %v", header.Name, err)
+		}
+		if len(path) != 0 && header.Typeflag == tar.TypeDir {
+			dirHeaders = append(dirHeaders, header)
+			dirPaths = append(dirPaths, path)
+		}
+	}
+
+	for i := len(dirHeaders) - 1; i >= 0; i-- {
+		if err := os.Chtimes(dirPaths[i], accessTime(dirHeaders[i]), dirHeaders[i].ModTime); err != nil {
+			return fmt.Errorf("Chtimes() %s error %v", dirPaths[i], err)
+		}
+	}
+
+	return nil
+}
+
+// Create the file of the entry under root and return its path, or an empty
+// path if nothing is created for it.
+func extractTarEntry(reader io.Reader, header *tar.Header, root string) (string, error) {
+	// Cleaning an absolute path drops every leading '..'.
+	name := filepath.Clean("/" + header.Name)
+	dir, base := filepath.Split(name)
+	parent, err := secureJoin(root, dir)
+	if err != nil {
+		return "", fmt.Errorf("secureJoin() %s error %v", dir, err)
+	}
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", fmt.Errorf("MkdirAll() %s error %v", parent, err)
+	}
+
+	if base == WHITEOUT_OPAQUE {
+		if err := syscall.Setxattr(parent, OVERLAY_OPAQUE_XATTR, []byte("y"), 0); err != nil {
+			return "", fmt.Errorf("Setxattr() %s %s error %v", parent, OVERLAY_OPAQUE_XATTR, err)
+		}
+		return "", nil
+	}
+	if strings.HasPrefix(base, WHITEOUT_PREFIX) {
+		hidden := strings.TrimPrefix(base, WHITEOUT_PREFIX)
+		if len(hidden) == 0 || hidden == "." || hidden == ".." {
+			return "", fmt.Errorf("Invalid whiteout %s", header.Name)
+		}
+		// A whiteout is a character device 0:0.
+		path := filepath.Join(parent, hidden)
+		if err := os.RemoveAll(path); err != nil {
+			return "", fmt.Errorf("RemoveAll() %s error %v", path, err)
+		}
+		if err := syscall.Mknod(path, syscall.S_IFCHR, 0); err != nil {
+			return "", fmt.Errorf("Mknod() whiteout %s error %v", path, err)
+		}
+		return "", nil
+	}
+
+	// The entry of the root itself only carries its metadata.
+	path := filepath.Join(parent, base)
+	if path == filepath.Clean(root) && header.Typeflag != tar.TypeDir {
+		return "", fmt.Errorf("Root %s is not a directory", header.Name)
+	}
+	// Replace whatever is there, except a directory by a directory.
+	if info, err := os.Lstat(path); err == nil && !(info.IsDir() && header.Typeflag == tar.TypeDir) {
+		if err := os.RemoveAll(path); err != nil {
+			return "", fmt.Errorf("RemoveAll() %s error %v", path, err)
+		}
+	}
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if err := os.Mkdir(path, 0755); err != nil && !os.IsExist(err) {
+			return "", fmt.Errorf("Mkdir() %s error %v", path, err)
+		}
+	case tar.TypeReg, tar.TypeRegA, tar.TypeGNUSparse:
+		if err := extractFile(reader, header, path); err != nil {
+			return "", fmt.Errorf("extractFile() %s error %v", path, err)
+		}
+	case tar.TypeSymlink:
+		// The target is kept as is, since it is resolved in the container.
+		if err := os.Symlink(header.Linkname, path); err != nil {
+			return "", fmt.Errorf("Symlink() %s to %s error %v", path, header.Linkname, err)
+		}
+		if err := os.Lchown(path, header.Uid, header.Gid); err != nil {
+			return "", fmt.Errorf("Lchown() %s error %v", path, err)
+		}
+		return path, nil
+	case tar.TypeLink:
+		linkName := filepath.Clean("/" + header.Linkname)
+		linkDir, linkBase := filepath.Split(linkName)
+		linkParent, err := secureJoin(root, linkDir)
+		if err != nil {
+			return "", fmt.Errorf("secureJoin() %s error %v", linkDir, err)
+		}
+		// link(2) does not follow a symlink at the end.
+		linkPath := filepath.Join(linkParent, linkBase)
+		if err := os.Link(linkPath, path); err != nil {
+			return "", fmt.Errorf("Link() %s to %s error %v", path, linkPath, err)
+		}
+		return path, nil
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		mode := map[byte]uint32{
+			tar.TypeChar:  syscall.S_IFCHR,
+			tar.TypeBlock: syscall.S_IFBLK,
+			tar.TypeFifo:  syscall.S_IFIFO,
+		}[header.Typeflag]
+		if err := syscall.Mknod(path, mode|uint32(header.Mode&07777), mkdev(header.Devmajor, header.Devminor)); err != nil {
+			return "", fmt.Errorf("Mknod() %s error %v", path, err)
+		}
+	case tar.TypeXGlobalHeader:
+		return "", nil
+	default:
+		return "", fmt.Errorf("Unsupported type %c", header.Typeflag)
+	}
+
+	// Changing the owner clears the set-user-ID and set-group-ID bits, so
+	// the mode is set after it.
+	if err := os.Lchown(path, header.Uid, header.Gid); err != nil {
+		return "", fmt.Errorf("Lchown() %s error %v", path, err)
+	}
+	if err := syscall.Chmod(path, uint32(header.Mode&07777)); err != nil {
+		return "", fmt.Errorf("Chmod() %s error %v", path, err)
+	}
+	for key, val := range header.PAXRecords {
+		if !strings.HasPrefix(key, PAX_XATTR_PREFIX) {
+			continue
+		}
+		xattr := strings.TrimPrefix(key, PAX_XATTR_PREFIX)
+		if err := syscall.Setxattr(path, xattr, []byte(val), 0); err != nil {
+			// Like tar, skip what the filesystem does not support.
+			if err == syscall.EOPNOTSUPP {
+				log.Warnf("Setxattr() %s %s is not supported", path, xattr)
+				continue
+			}
+			return "", fmt.Errorf("Setxattr() %s %s error %v", path, xattr, err)
+		}
+	}
+	if header.Typeflag != tar.TypeDir {
+		if err := os.Chtimes(path, accessTime(header), header.ModTime); err != nil {
+			return "", fmt.Errorf("Chtimes() %s error %v", path, err)
+		}
+	}
+
+	return path, nil
+}
+
+// Write the content of a regular file. The holes of a sparse file are
+// skipped instead of written as zeros.
+func extractFile(reader io.Reader, header *tar.Header, path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("OpenFile() %s error %v", path, err)
+	}
+	defer f.Close()
+
+	if !isSparse(header) {
+		if _, err := io.Copy(f, reader); err != nil {
+			return fmt.Errorf("Copy() to %s error %v", path, err)
+		}
+		return nil
+	}
+
+	buf := make([]byte, 32*1024)
+	zeros := make([]byte, len(buf))
+	for {
+		n, err := io.ReadFull(reader, buf)
+		if n != 0 {
+			if bytes.Equal(buf[:n], zeros[:n]) {
+				if _, err := f.Seek(int64(n), io.SeekCurrent); err != nil {
+					return fmt.Errorf("Seek() %s error %v", path, err)
+				}
+			} else if _, err := f.Write(buf[:n]); err != nil {
+				return fmt.Errorf("Write() %s error %v", path, err)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Read() content of %s error %v", path, err)
+		}
+	}
+	// Seeking does not extend a file ending with a hole.
+	if err := f.Truncate(header.Size); err != nil {
+		return fmt.Errorf("Truncate() %s to %d error %v", path, header.Size, err)
+	}
+
+	return nil
+}
+
+func isSparse(header *tar.Header) bool {
+	if header.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for key := range header.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func accessTime(header *tar.Header) time.Time {
+	if header.AccessTime.IsZero() {
+		return header.ModTime
+	}
+
+	return header.AccessTime
+}
+
+// Encode a device number like makedev(3) of glibc.
+func mkdev(major, minor int64) int {
+	return int((minor & 0xff) | ((major & 0xfff) << 8) | ((minor &^ 0xff) << 12) | ((major &^ 0xfff) << 32))
+}
+
+// Resolve name under root as if root were the filesystem root: symlinks
+// inside root are followed, absolute ones restart from root and '..' stops
+// at root. Missing components are joined as they are.
+func secureJoin(root, name string) (string, error) {
+	resolved := ""
+	unresolved := name
+	symlinks := 0
+	for len(unresolved) != 0 {
+		component := unresolved
+		unresolved = ""
+		if i := strings.IndexByte(component, '/'); i >= 0 {
+			component, unresolved = component[:i], component[i+1:]
+		}
+
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			if resolved = filepath.Dir(resolved); resolved == "." {
+				resolved = ""
+			}
+			continue
+		}
+
+		next := filepath.Join(resolved, component)
+		info, err := os.Lstat(filepath.Join(root, next))
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("Lstat() %s error %v", filepath.Join(root, next), err)
+		}
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		if symlinks++; symlinks > MAX_SYMLINKS {
+			return "", fmt.Errorf("Too many symlinks in %s", name)
+		}
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", fmt.Errorf("Readlink() %s error %v", filepath.Join(root, next), err)
+		}
+		if filepath.IsAbs(target) {
+			resolved = ""
+		}
+		unresolved = target + "/" + unresolved
+	}
+
+	return filepath.Join(root, resolved), nil
+}
@@ -0,0 +1,93 @@
+package container
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestExtractTar(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Extracting ownership, devices and whiteouts requires root")
+	}
+	dirPath, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatalf("TempDir() error %v", err)
+	}
+	defer os.RemoveAll(dirPath)
+	root := filepath.Join(dirPath, "root")
+
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	entries := []struct {
+		header  tar.Header
+		content string
+	}{
+		{tar.Header{Typeflag: tar.TypeDir, Name: "./", Mode: 0755}, ""},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "../../escaped", Mode: 04755, Uid: 1, Gid: 2}, "a"},
+		{tar.Header{Typeflag: tar.TypeSymlink, Name: "abs", Linkname: "/"}, ""},
+		{tar.Header{Typeflag: tar.TypeSymlink, Name: "up", Linkname: "../../.."}, ""},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "abs/etc/passwd", Mode: 0644}, "b"},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "up/x", Mode: 0644}, "c"},
+		{tar.Header{Typeflag: tar.TypeLink, Name: "hardlink", Linkname: "../escaped"}, ""},
+		{tar.Header{Typeflag: tar.TypeChar, Name: "null", Mode: 0666, Devmajor: 1, Devminor: 3}, ""},
+		{tar.Header{Typeflag: tar.TypeDir, Name: "opaque/", Mode: 0700}, ""},
+		{tar.Header{Typeflag: tar.TypeReg, Name: "opaque/.wh..wh..opq"}, ""},
+		{tar.Header{Typeflag: tar.TypeReg, Name: ".wh.gone"}, ""},
+	}
+	for _, e := range entries {
+		e.header.Size = int64(len(e.content))
+		if err := tarWriter.WriteHeader(&e.header); err != nil {
+			t.Fatalf("WriteHeader() %s error %v", e.header.Name, err)
+		}
+		if _, err := tarWriter.Write([]byte(e.content)); err != nil {
+			t.Fatalf("Write() %s error %v", e.header.Name, err)
+		}
+	}
+	tarWriter.Close()
+
+	if err := ExtractTar(&buf, root); err != nil {
+		t.Fatalf("ExtractTar() error %v", err)
+	}
+
+	if _, err := os.Lstat(filepath.Join(dirPath, "escaped")); !os.IsNotExist(err) {
+		t.Errorf("Entry escaped from root, Lstat() error %v", err)
+	}
+	for path, want := range map[string]string{"escaped": "a", "etc/passwd": "b", "x": "c", "hardlink": "a"} {
+		got, err := ioutil.ReadFile(filepath.Join(root, path))
+		if err != nil || string(got) != want {
+			t.Errorf("ReadFile() %s = %q, %v, want %q", path, got, err, want)
+		}
+	}
+
+	var stat syscall.Stat_t
+	if err := syscall.Stat(filepath.Join(root, "escaped"), &stat); err != nil {
+		t.Fatalf("Stat() escaped error %v", err)
+	}
+	if stat.Mode&07777 != 04755 || stat.Uid != 1 || stat.Gid != 2 || stat.Nlink != 2 {
+		t.Errorf("escaped mode %o, owner %d:%d, links %d", stat.Mode&07777, stat.Uid, stat.Gid, stat.Nlink)
+	}
+	if err := syscall.Stat(filepath.Join(root, "null"), &stat); err != nil {
+		t.Fatalf("Stat() null error %v", err)
+	}
+	if stat.Mode&syscall.S_IFMT != syscall.S_IFCHR || stat.Rdev != uint64(mkdev(1, 3)) {
+		t.Errorf("null mode %o, rdev %d", stat.Mode, stat.Rdev)
+	}
+	if err := syscall.Stat(filepath.Join(root, "gone"), &stat); err != nil {
+		t.Fatalf("Stat() whiteout error %v", err)
+	}
+	if stat.Mode&syscall.S_IFMT != syscall.S_IFCHR || stat.Rdev != 0 {
+		t.Errorf("whiteout mode %o, rdev %d", stat.Mode, stat.Rdev)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "opaque", WHITEOUT_OPAQUE)); !os.IsNotExist(err) {
+		t.Errorf("Opaque whiteout is extracted, Lstat() error %v", err)
+	}
+	opaque := make([]byte, 1)
+	if _, err := syscall.Getxattr(filepath.Join(root, "opaque"), OVERLAY_OPAQUE_XATTR, opaque); err != nil || opaque[0] != 'y' {
+		t.Errorf("Getxattr() %s = %q, %v", OVERLAY_OPAQUE_XATTR, opaque, err)
+	}
+}
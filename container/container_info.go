@@ -0,0 +1,181 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Load the information of container containerName from
+// DEFAULT_INFO_DIR_PATH/containerName/CONFIG_FILE_NAME.
+func LoadContainerInfo(containerName string) (*ContainerInfo, error) {
+	configPath := filepath.Join(DEFAULT_INFO_DIR_PATH, containerName, CONFIG_FILE_NAME)
+	contentBytes, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("ReadFile() %s error %v", configPath, err)
+	}
+
+	containerInfo := &ContainerInfo{}
+	if err := json.Unmarshal(contentBytes, containerInfo); err != nil {
+		return nil, fmt.Errorf("Unmarshal() %s error %v", configPath, err)
+	}
+
+	return containerInfo, nil
+}
+
+// Load the information of all the containers under DEFAULT_INFO_DIR_PATH.
+// Directories without a valid config file are skipped.
+func ListContainerInfos() ([]*ContainerInfo, error) {
+	dirInfos, err := ioutil.ReadDir(DEFAULT_INFO_DIR_PATH)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ReadDir() %s error %v", DEFAULT_INFO_DIR_PATH, err)
+	}
+
+	var containerInfos []*ContainerInfo
+	for _, dirInfo := range dirInfos {
+		if !dirInfo.IsDir() {
+			continue
+		}
+		containerInfo, err := LoadContainerInfo(dirInfo.Name())
+		if err != nil {
+			continue
+		}
+		containerInfos = append(containerInfos, containerInfo)
+	}
+
+	return containerInfos, nil
+}
+
+// Create the directory of the information of container containerName.
+// It fails if the directory exists, so that concurrent dicker processes never
+// create two containers of the same name.
+func CreateContainerInfoDir(containerName string) error {
+	if err := os.MkdirAll(DEFAULT_INFO_DIR_PATH, 0622); err != nil {
+		return fmt.Errorf("MkdirAll() %s error %v", DEFAULT_INFO_DIR_PATH, err)
+	}
+	dirPath := filepath.Join(DEFAULT_INFO_DIR_PATH, containerName)
+	if err := os.Mkdir(dirPath, 0622); err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("Container %s already exists", containerName)
+		}
+		return fmt.Errorf("Mkdir() %s error %v", dirPath, err)
+	}
+
+	return nil
+}
+
+// Write the information of the container to
+// DEFAULT_INFO_DIR_PATH/Name/CONFIG_FILE_NAME.
+func (c *ContainerInfo) Dump() error {
+	jsonBytes, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("Marshal() %v error %v", c, err)
+	}
+
+	dirPath := filepath.Join(DEFAULT_INFO_DIR_PATH, c.Name)
+	if err := os.MkdirAll(dirPath, 0622); err != nil {
+		return fmt.Errorf("MkdirAll() %s error %v", dirPath, err)
+	}
+	// Write to a temporary file and rename it, since the config file may be
+	// read or written by other dicker processes at the same time.
+	filePath := filepath.Join(dirPath, CONFIG_FILE_NAME)
+	tmpFilePath := fmt.Sprintf("%s.%d.tmp", filePath, os.Getpid())
+	if err := ioutil.WriteFile(tmpFilePath, jsonBytes, 0644); err != nil {
+		return fmt.Errorf("WriteFile() %s error %v", tmpFilePath, err)
+	}
+	if err := os.Rename(tmpFilePath, filePath); err != nil {
+		return fmt.Errorf("Rename() %s to %s error %v", tmpFilePath, filePath, err)
+	}
+
+	return nil
+}
+
+// Take the exclusive lock of the information of container containerName,
+// and return the function to release it.
+// Hold it from loading the information to dumping it, so that the changes
+// made by other dicker processes meanwhile are not overwritten.
+// The lock is not reentrant, even in the same process.
+func LockContainerInfo(containerName string) (func(), error) {
+	lockFilePath := filepath.Join(DEFAULT_INFO_DIR_PATH, containerName, CONFIG_LOCK_FILE_NAME)
+	lockFile, err := os.OpenFile(lockFilePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("OpenFile() %s error %v", lockFilePath, err)
+	}
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		lockFile.Close()
+		return nil, fmt.Errorf("Flock() %s error %v", lockFilePath, err)
+	}
+
+	return func() {
+		syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+		lockFile.Close()
+	}, nil
+}
+
+// Lock and load the information of container containerName.
+// Call the returned function to release the lock after dumping it.
+func LoadContainerInfoLocked(containerName string) (*ContainerInfo, func(), error) {
+	unlock, err := LockContainerInfo(containerName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("LockContainerInfo() %s error %v", containerName, err)
+	}
+	containerInfo, err := LoadContainerInfo(containerName)
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+
+	return containerInfo, unlock, nil
+}
+
+// Delete DEFAULT_INFO_DIR_PATH/Name, including the config file and the log file.
+func (c *ContainerInfo) Remove() error {
+	dirPath := filepath.Join(DEFAULT_INFO_DIR_PATH, c.Name)
+	if err := os.RemoveAll(dirPath); err != nil {
+		return fmt.Errorf("RemoveAll() %s error %v", dirPath, err)
+	}
+
+	return nil
+}
+
+// Correct the recorded status if the container is recorded as running
+// but its init process is gone.
+// The recorded status is written at creation and may be stale.
+func (c *ContainerInfo) RefreshStatus() {
+	if (c.Status == STATUS_RUNNING || c.Status == STATUS_PAUSED) && !IsProcessAlive(c.Pid) {
+		c.Status = STATUS_EXITED
+	}
+}
+
+// Check /proc/pid to see whether the process exists and is not a zombie.
+func IsProcessAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+
+	statPath := filepath.Join("/proc", strconv.Itoa(pid), "stat")
+	contentBytes, err := ioutil.ReadFile(statPath)
+	if err != nil {
+		return false
+	}
+
+	// The format is: pid (comm) state ...
+	// comm may contain spaces and parentheses, so find the last ')'.
+	content := string(contentBytes)
+	idx := strings.LastIndex(content, ")")
+	if idx < 0 || idx+2 >= len(content) {
+		return false
+	}
+
+	// Z: zombie, X: dead.
+	state := content[idx+2]
+	return state != 'Z' && state != 'X'
+}
@@ -2,20 +2,28 @@ package container
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"syscall"
+
+	"github.com/chengzeyi/dicker/cgroups"
 )
 
 const (
+	STATUS_CREATED          = "created"
 	STATUS_RUNNING          = "runing"
 	STATUS_STOPPED          = "stopped"
 	STATUS_EXITED           = "exited"
+	STATUS_RESTARTING       = "restarting"
+	STATUS_PAUSED           = "paused"
 
 	DEFAULT_INFO_DIR_PATH   = "/var/run/dicker/info"
 	CONFIG_FILE_NAME        = "config.json"
+	CONFIG_LOCK_FILE_NAME   = "config.lock"
 	CONTAINER_LOG_FILE_NAME = "container.log"
+	SHIM_LOG_FILE_NAME      = "shim.log"
 	// ROOT_DIR_PATH           = "/root"
 	MNT_DIR_PATH            = "/root/.dicker/mnt"
 	IMAGE_DIR_PATH          = "/root/.dicker/image"
@@ -29,28 +37,62 @@ const (
 )
 
 type ContainerInfo struct {
-	Pid           int   `json:"pid"`          // Container init process's pid on the host OS.
-	Id            string   `json:"id"`           // Container id.
-	Name          string   `json:"name"`         // Container name.
-	Command       string   `json:"command"`      // Container init command.
-	CreateTime    string   `json:"create_time"`  // Container created time.
-	Status        string   `json:"status"`       // Container status description.
-	VolumeMapping string   `json:"volume_mapping"`       // Container data volume mapping.
-	PortMappings  []string `json:"port_mappings"` // Container port mapping.
+	Pid                     int                     `json:"pid"`                       // Container init process's pid on the host OS.
+	Id                      string                  `json:"id"`                        // Container id.
+	Name                    string                  `json:"name"`                      // Container name.
+	Image                   string                  `json:"image"`                     // Container image name.
+	Command                 string                  `json:"command"`                   // Container init command.
+	Args                    []string                `json:"args"`                      // Container init command and its arguments.
+	Envs                    []string                `json:"envs"`                      // Container init process's environment variables.
+	WorkDir                 string                  `json:"work_dir"`                  // Working directory of the init command in the container.
+	Hostname                string                  `json:"hostname"`                  // Container hostname.
+	User                    string                  `json:"user"`                      // User of the init command, like user[:group].
+	Rlimits                 []Rlimit                `json:"rlimits"`                   // Resource limits of the init command.
+	CreateTime              string                  `json:"create_time"`               // Container created time.
+	Status                  string                  `json:"status"`                    // Container status description.
+	Mounts                  []*VolumeMount          `json:"mounts"`                    // Container volumes bound in order.
+	PortMappings            []string                `json:"port_mappings"`             // Container port mapping.
+	Labels                  map[string]string       `json:"labels"`                    // Container labels.
+	FinishTime              string                  `json:"finish_time"`               // Container finished time.
+	ExitCode                int                     `json:"exit_code"`                 // Container init process's exit code.
+	OOMKilled               bool                    `json:"oom_killed"`                // Whether the container has been killed by the OOM killer.
+	Error                   string                  `json:"error"`                     // Why the container failed to start, empty if it started.
+	ManuallyStopped         bool                    `json:"manually_stopped"`          // Whether the container is being stopped by 'dicker stop'.
+	RestartPolicy           string                  `json:"restart_policy"`            // Container restart policy.
+	RestartCount            int                     `json:"restart_count"`             // Number of restarts by the shim.
+	CgroupPath              string                  `json:"cgroup_path"`               // Container cgroup path in the hierarchy.
+	Resources               *cgroups.ResourceConfig `json:"resources"`                 // Container resource limitations.
+	MemoryPressureThreshold float64                 `json:"memory_pressure_threshold"` // Memory pressure percentage to emit an event, 0 for none.
+	Network                 string                  `json:"network"`                   // Container connected network name.
+	Ip                      net.IP                  `json:"ip"`                        // Container IP address in the network.
 }
 
-func NewParentProcess(tty bool, volumeMapping, imageName, containerName string, envs []string) (*exec.Cmd, *os.File, error) {
-	rPipe, wPipe, err := os.Pipe()
+// The workspace of the container should have been created by NewWorkspace.
+// The init process reads an InitConfig from the returned config pipe, and
+// reports an InitResult to the returned result pipe if it fails.
+// Both pipes should be closed by the caller once the process is started.
+func NewParentProcess(tty bool, containerName string) (*exec.Cmd, *os.File, *os.File, error) {
+	rConfig, wConfig, err := os.Pipe()
 	if err != nil {
-		return nil, nil, fmt.Errorf("Pipe() error %v", err)
+		return nil, nil, nil, fmt.Errorf("Pipe() error %v", err)
 	}
-	selfCmd, err := os.Readlink("/proc/self/exe")
+	rResult, wResult, err := os.Pipe()
 	if err != nil {
-		return nil, nil, fmt.Errorf("Readlink() /proc/self/exe error %v", err)
+		rConfig.Close()
+		wConfig.Close()
+		return nil, nil, nil, fmt.Errorf("Pipe() error %v", err)
+	}
+	// Close the ends kept by the child on failure.
+	closePipes := func() {
+		rConfig.Close()
+		wConfig.Close()
+		rResult.Close()
+		wResult.Close()
 	}
-	
-	if err := NewWorkspace(volumeMapping, imageName, containerName); err != nil {
-		return nil, nil, fmt.Errorf("NewWorkspace() with volume mapping %s, image name %s and containerName %s error %v", volumeMapping, imageName, containerName, err)
+	selfCmd, err := os.Readlink("/proc/self/exe")
+	if err != nil {
+		closePipes()
+		return nil, nil, nil, fmt.Errorf("Readlink() /proc/self/exe error %v", err)
 	}
 
 	initCmd := exec.Command(selfCmd, COMMAND_INIT)
@@ -71,22 +113,25 @@ func NewParentProcess(tty bool, volumeMapping, imageName, containerName string,
 	} else {
 		dirPath := filepath.Join(DEFAULT_INFO_DIR_PATH, containerName)
 		if err := os.MkdirAll(dirPath, 0622); err != nil {
-			return nil, nil, fmt.Errorf("MkdirAll() %s error %v", dirPath, err)
+			closePipes()
+			return nil, nil, nil, fmt.Errorf("MkdirAll() %s error %v", dirPath, err)
 		}
-		stdOutLogFilePath := filepath.Join(dirPath, CONTAINER_LOG_FILE_NAME)
-		stdOutLogFile, err := os.Create(stdOutLogFilePath)
+		// Both stdout and stderr are captured by the logger process.
+		stdout, stderr, err := startLogger(selfCmd, containerName)
 		if err != nil {
-			return nil, nil, fmt.Errorf("Create() %s error %v", stdOutLogFilePath, err)
+			closePipes()
+			return nil, nil, nil, fmt.Errorf("startLogger() %s error %v", containerName, err)
 		}
-		initCmd.Stdout = stdOutLogFile
+		initCmd.Stdout = stdout
+		initCmd.Stderr = stderr
 	}
 
+	// They become fd 3 and fd 4 of the child.
 	initCmd.ExtraFiles = []*os.File{
-		rPipe,
+		rConfig,
+		wResult,
 	}
-	// If Env is specified, the original environment variables will be overridden.
-	initCmd.Env = append(os.Environ(), envs...)
 	initCmd.Dir = filepath.Join(MNT_DIR_PATH, containerName)
 
-	return initCmd, wPipe, nil
+	return initCmd, wConfig, rResult, nil
 }
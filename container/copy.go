@@ -0,0 +1,204 @@
+package container
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Copy the contents of the directory src into the existing directory dst,
+// like cp -a src/. dst. Symlinks are copied as they are and never followed.
+// Ownership, modes, times, extended attributes, hardlinks and devices are
+// kept, and dst gets the ownership, mode and times of src.
+func copyTree(src, dst string) error {
+	// The times of directories are set last, since copying their children
+	// changes them.
+	var dirStats []*syscall.Stat_t
+	var dirPaths []string
+	// Paths of the files with more than one link, keyed by the source inode.
+	links := map[[2]uint64]string{}
+	err := filepath.Walk(src, func(srcPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(src, srcPath)
+		if err != nil {
+			return fmt.Errorf("Rel() %s error %v", srcPath, err)
+		}
+		dstPath := filepath.Join(dst, relPath)
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return fmt.Errorf("Unknown stat of %s", srcPath)
+		}
+
+		if !info.IsDir() && stat.Nlink > 1 {
+			inode := [2]uint64{uint64(stat.Dev), stat.Ino}
+			if linkPath, ok := links[inode]; ok {
+				if err := os.Link(linkPath, dstPath); err != nil {
+					return fmt.Errorf("Link() %s to %s error %v", dstPath, linkPath, err)
+				}
+				return nil
+			}
+			links[inode] = dstPath
+		}
+
+		if err := copyTreeEntry(srcPath, dstPath, info, stat); err != nil {
+			return fmt.Errorf("copyTreeEntry() %s error %v", srcPath, err)
+		}
+		if info.IsDir() {
+			dirStats = append(dirStats, stat)
+			dirPaths = append(dirPaths, dstPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Walk() %s error %v", src, err)
+	}
+
+	for i := len(dirStats) - 1; i >= 0; i-- {
+		if err := os.Chtimes(dirPaths[i], statAccessTime(dirStats[i]), statModTime(dirStats[i])); err != nil {
+			return fmt.Errorf("Chtimes() %s error %v", dirPaths[i], err)
+		}
+	}
+
+	return nil
+}
+
+// Create dstPath like srcPath. The root of the tree already exists.
+func copyTreeEntry(srcPath, dstPath string, info os.FileInfo, stat *syscall.Stat_t) error {
+	switch mode := info.Mode(); {
+	case mode.IsDir():
+		if err := os.Mkdir(dstPath, 0700); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("Mkdir() %s error %v", dstPath, err)
+		}
+	case mode.IsRegular():
+		if err := copyFile(srcPath, dstPath); err != nil {
+			return fmt.Errorf("copyFile() %s error %v", dstPath, err)
+		}
+	case mode&os.ModeSymlink != 0:
+		linkName, err := os.Readlink(srcPath)
+		if err != nil {
+			return fmt.Errorf("Readlink() %s error %v", srcPath, err)
+		}
+		if err := os.Symlink(linkName, dstPath); err != nil {
+			return fmt.Errorf("Symlink() %s to %s error %v", dstPath, linkName, err)
+		}
+		if err := os.Lchown(dstPath, int(stat.Uid), int(stat.Gid)); err != nil {
+			return fmt.Errorf("Lchown() %s error %v", dstPath, err)
+		}
+		return nil
+	case mode&(os.ModeDevice|os.ModeNamedPipe|os.ModeSocket) != 0:
+		if err := syscall.Mknod(dstPath, stat.Mode, int(stat.Rdev)); err != nil {
+			return fmt.Errorf("Mknod() %s error %v", dstPath, err)
+		}
+	default:
+		return fmt.Errorf("Unsupported mode %v", mode)
+	}
+
+	// Changing the owner clears the set-user-ID and set-group-ID bits, so
+	// the mode is set after it.
+	if err := os.Lchown(dstPath, int(stat.Uid), int(stat.Gid)); err != nil {
+		return fmt.Errorf("Lchown() %s error %v", dstPath, err)
+	}
+	if err := syscall.Chmod(dstPath, stat.Mode&07777); err != nil {
+		return fmt.Errorf("Chmod() %s error %v", dstPath, err)
+	}
+	if err := copyXattrs(srcPath, dstPath); err != nil {
+		return fmt.Errorf("copyXattrs() %s error %v", dstPath, err)
+	}
+	if !info.IsDir() {
+		if err := os.Chtimes(dstPath, statAccessTime(stat), statModTime(stat)); err != nil {
+			return fmt.Errorf("Chtimes() %s error %v", dstPath, err)
+		}
+	}
+
+	return nil
+}
+
+func copyFile(srcPath, dstPath string) error {
+	srcFile, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("Open() %s error %v", srcPath, err)
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("OpenFile() %s error %v", dstPath, err)
+	}
+	defer dstFile.Close()
+
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		return fmt.Errorf("Copy() %s to %s error %v", srcPath, dstPath, err)
+	}
+
+	return nil
+}
+
+// Copy the extended attributes of a file that is not a symlink.
+func copyXattrs(srcPath, dstPath string) error {
+	size, err := syscall.Listxattr(srcPath, nil)
+	if err != nil {
+		// Like cp -a, skip what the filesystem does not support.
+		if err == syscall.EOPNOTSUPP {
+			return nil
+		}
+		return fmt.Errorf("Listxattr() %s error %v", srcPath, err)
+	}
+	if size == 0 {
+		return nil
+	}
+	buf := make([]byte, size)
+	if size, err = syscall.Listxattr(srcPath, buf); err != nil {
+		return fmt.Errorf("Listxattr() %s error %v", srcPath, err)
+	}
+
+	// The names are separated by '\0'.
+	for _, name := range splitNullTerminated(buf[:size]) {
+		valSize, err := syscall.Getxattr(srcPath, name, nil)
+		if err != nil {
+			return fmt.Errorf("Getxattr() %s %s error %v", srcPath, name, err)
+		}
+		val := make([]byte, valSize)
+		if valSize, err = syscall.Getxattr(srcPath, name, val); err != nil {
+			return fmt.Errorf("Getxattr() %s %s error %v", srcPath, name, err)
+		}
+		if err := syscall.Setxattr(dstPath, name, val[:valSize], 0); err != nil {
+			if err == syscall.EOPNOTSUPP {
+				log.Warnf("Setxattr() %s %s is not supported", dstPath, name)
+				continue
+			}
+			return fmt.Errorf("Setxattr() %s %s error %v", dstPath, name, err)
+		}
+	}
+
+	return nil
+}
+
+func splitNullTerminated(buf []byte) []string {
+	var strs []string
+	start := 0
+	for i, b := range buf {
+		if b == 0 {
+			if i > start {
+				strs = append(strs, string(buf[start:i]))
+			}
+			start = i + 1
+		}
+	}
+
+	return strs
+}
+
+func statAccessTime(stat *syscall.Stat_t) time.Time {
+	return time.Unix(int64(stat.Atim.Sec), int64(stat.Atim.Nsec))
+}
+
+func statModTime(stat *syscall.Stat_t) time.Time {
+	return time.Unix(int64(stat.Mtim.Sec), int64(stat.Mtim.Nsec))
+}
@@ -0,0 +1,106 @@
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCopyTree(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Copying ownership and devices requires root")
+	}
+	dirPath, err := ioutil.TempDir("", "copy")
+	if err != nil {
+		t.Fatalf("TempDir() error %v", err)
+	}
+	defer os.RemoveAll(dirPath)
+	src := filepath.Join(dirPath, "src")
+	dst := filepath.Join(dirPath, "dst")
+	for _, path := range []string{src, dst, filepath.Join(src, "dir")} {
+		if err := os.Mkdir(path, 0755); err != nil {
+			t.Fatalf("Mkdir() error %v", err)
+		}
+	}
+
+	filePath := filepath.Join(src, "dir", "file")
+	if err := ioutil.WriteFile(filePath, []byte("a"), 0644); err != nil {
+		t.Fatalf("WriteFile() error %v", err)
+	}
+	if err := os.Lchown(filePath, 1, 2); err != nil {
+		t.Fatalf("Lchown() error %v", err)
+	}
+	if err := syscall.Chmod(filePath, 04755); err != nil {
+		t.Fatalf("Chmod() error %v", err)
+	}
+	xattrSupported := true
+	if err := syscall.Setxattr(filePath, "user.dicker", []byte("x"), 0); err != nil {
+		xattrSupported = false
+	}
+	if err := os.Link(filePath, filepath.Join(src, "hardlink")); err != nil {
+		t.Fatalf("Link() error %v", err)
+	}
+	if err := os.Symlink("/dir/file", filepath.Join(src, "symlink")); err != nil {
+		t.Fatalf("Symlink() error %v", err)
+	}
+	if err := syscall.Mknod(filepath.Join(src, "null"), syscall.S_IFCHR|0666, mkdev(1, 3)); err != nil {
+		t.Fatalf("Mknod() error %v", err)
+	}
+	modTime := time.Unix(1000000000, 0)
+	for _, path := range []string{filePath, filepath.Join(src, "dir"), src} {
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Chtimes() error %v", err)
+		}
+	}
+	if err := os.Chmod(src, 0700); err != nil {
+		t.Fatalf("Chmod() error %v", err)
+	}
+
+	if err := copyTree(src, dst); err != nil {
+		t.Fatalf("copyTree() error %v", err)
+	}
+
+	for _, path := range []string{"dir/file", "hardlink"} {
+		got, err := ioutil.ReadFile(filepath.Join(dst, path))
+		if err != nil || string(got) != "a" {
+			t.Errorf("ReadFile() %s = %q, %v, want a", path, got, err)
+		}
+	}
+	var stat syscall.Stat_t
+	if err := syscall.Stat(filepath.Join(dst, "dir/file"), &stat); err != nil {
+		t.Fatalf("Stat() file error %v", err)
+	}
+	if stat.Mode&07777 != 04755 || stat.Uid != 1 || stat.Gid != 2 || stat.Nlink != 2 {
+		t.Errorf("file mode %o, owner %d:%d, links %d", stat.Mode&07777, stat.Uid, stat.Gid, stat.Nlink)
+	}
+	if xattrSupported {
+		val := make([]byte, 1)
+		if _, err := syscall.Getxattr(filepath.Join(dst, "dir/file"), "user.dicker", val); err != nil || val[0] != 'x' {
+			t.Errorf("Getxattr() user.dicker = %q, %v", val, err)
+		}
+	}
+	if linkName, err := os.Readlink(filepath.Join(dst, "symlink")); err != nil || linkName != "/dir/file" {
+		t.Errorf("Readlink() symlink = %s, %v, want /dir/file", linkName, err)
+	}
+	if err := syscall.Stat(filepath.Join(dst, "null"), &stat); err != nil {
+		t.Fatalf("Stat() null error %v", err)
+	}
+	if stat.Mode&syscall.S_IFMT != syscall.S_IFCHR || stat.Rdev != uint64(mkdev(1, 3)) {
+		t.Errorf("null mode %o, rdev %d", stat.Mode, stat.Rdev)
+	}
+	for _, path := range []string{"dir/file", "dir", "."} {
+		info, err := os.Stat(filepath.Join(dst, path))
+		if err != nil {
+			t.Fatalf("Stat() %s error %v", path, err)
+		}
+		if !info.ModTime().Equal(modTime) {
+			t.Errorf("%s mtime %v, want %v", path, info.ModTime(), modTime)
+		}
+	}
+	if info, err := os.Stat(dst); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("Stat() dst = %v, %v, want mode 0700", info.Mode(), err)
+	}
+}
@@ -0,0 +1,57 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// All the events of all the containers are appended to this file.
+	EVENTS_FILE_PATH = "/var/run/dicker/events.log"
+
+	EVENT_OOM             = "oom"
+	EVENT_MEMORY_PRESSURE = "memory_pressure"
+)
+
+// One line of the events file.
+// The events file contains one JSON encoded event per line.
+type Event struct {
+	Time          time.Time         `json:"time"`
+	Type          string            `json:"type"`
+	ContainerId   string            `json:"container_id"`
+	ContainerName string            `json:"container_name"`
+	Attributes    map[string]string `json:"attributes,omitempty"`
+}
+
+// Append an event of the container to EVENTS_FILE_PATH.
+func EmitEvent(containerInfo *ContainerInfo, eventType string, attributes map[string]string) error {
+	event := &Event{
+		Time:          time.Now(),
+		Type:          eventType,
+		ContainerId:   containerInfo.Id,
+		ContainerName: containerInfo.Name,
+		Attributes:    attributes,
+	}
+	jsonBytes, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("Marshal() %v error %v", event, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(EVENTS_FILE_PATH), 0755); err != nil {
+		return fmt.Errorf("MkdirAll() %s error %v", filepath.Dir(EVENTS_FILE_PATH), err)
+	}
+	// A single write of a line with O_APPEND is not interleaved with others.
+	f, err := os.OpenFile(EVENTS_FILE_PATH, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("OpenFile() %s error %v", EVENTS_FILE_PATH, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(jsonBytes, '\n')); err != nil {
+		return fmt.Errorf("Write() %s error %v", EVENTS_FILE_PATH, err)
+	}
+
+	return nil
+}
@@ -1,56 +1,243 @@
 package container
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 
 	log "github.com/sirupsen/logrus"
 )
 
-const PIVOT_PUT_OLD_DIR_NAME = ".pivot_put_old"
+const (
+	PIVOT_PUT_OLD_DIR_NAME = ".pivot_put_old"
+	// Used to find the user command if there is no PATH.
+	DEFAULT_PATH_ENV = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+)
 
+// Set up the container as the config read from fd 3 says and execute the
+// user command.
+// Any error before the execution is reported to the parent on fd 4.
 func RunContainerInitProcess() error {
-	// Get the command to be executed.
-	cmdArr := readUserCommand()
-	if cmdArr == nil || len(cmdArr) == 0 {
-		return fmt.Errorf("Run container get user command error, cmdArr is nil")
+	// 3 and 4 are the file descriptors after 0(stdin), 1(stdout) and 2(stderr).
+	configPipe := os.NewFile(3, "config")
+	resultPipe := os.NewFile(4, "result")
+	// The parent gets EOF once the user command is executed.
+	syscall.CloseOnExec(int(resultPipe.Fd()))
+
+	err := initContainer(configPipe)
+	// Only reached on failure.
+	result := &InitResult{Error: err.Error()}
+	if jsonBytes, err := json.Marshal(result); err == nil {
+		resultPipe.Write(jsonBytes)
+	}
+	resultPipe.Close()
+
+	return err
+}
+
+func initContainer(configPipe *os.File) error {
+	config, err := ReadInitConfig(configPipe)
+	configPipe.Close()
+	if err != nil {
+		return fmt.Errorf("ReadInitConfig() error %v", err)
+	}
+
+	if len(config.Hostname) != 0 {
+		if err := syscall.Sethostname([]byte(config.Hostname)); err != nil {
+			return fmt.Errorf("Sethostname() %s error %v", config.Hostname, err)
+		}
+	}
+
+	if err := setupRootfs(config.Mounts); err != nil {
+		return fmt.Errorf("setupRootfs() error %v", err)
+	}
+
+	// The user is looked up in the files of the image.
+	uid, gid, home, err := lookupUser(config.User)
+	if err != nil {
+		return fmt.Errorf("lookupUser() %s error %v", config.User, err)
+	}
+	envs := config.Envs
+	if !hasEnv(envs, "HOME") {
+		envs = append(envs, "HOME="+home)
 	}
 
-	mount()
+	for _, rlimit := range config.Rlimits {
+		if err := syscall.Setrlimit(rlimit.Type, &syscall.Rlimit{Cur: rlimit.Soft, Max: rlimit.Hard}); err != nil {
+			return fmt.Errorf("Setrlimit() %d to %d:%d error %v", rlimit.Type, rlimit.Soft, rlimit.Hard, err)
+		}
+	}
 
-	path, err := exec.LookPath(cmdArr[0])
+	cwd := config.Cwd
+	if len(cwd) == 0 {
+		cwd = "/"
+	}
+	if err := os.Chdir(cwd); err != nil {
+		return fmt.Errorf("Working directory %s not found in image: %v", cwd, err)
+	}
+
+	path, err := lookPath(config.Args[0], envs)
+	if err != nil {
+		return fmt.Errorf("Executable %s not found in image: %v", config.Args[0], err)
+	}
+	log.Infof("Find path %s", path)
+
+	// Groups of the host are not inherited.
+	if err := syscall.Setgroups([]int{}); err != nil {
+		return fmt.Errorf("Setgroups() error %v", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("Setgid() %d error %v", gid, err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("Setuid() %d error %v", uid, err)
+	}
+
+	if err := syscall.Exec(path, config.Args, envs); err != nil {
+		return fmt.Errorf("Exec() %s error %v", path, err)
+	}
+
+	return nil
+}
+
+func hasEnv(envs []string, key string) bool {
+	for _, env := range envs {
+		if strings.HasPrefix(env, key+"=") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Find the executable file in the PATH of envs, like the shell does.
+func lookPath(file string, envs []string) (string, error) {
+	if strings.Contains(file, "/") {
+		if err := checkExecutable(file); err != nil {
+			return "", err
+		}
+		return file, nil
+	}
+
+	pathEnv := DEFAULT_PATH_ENV
+	for _, env := range envs {
+		if strings.HasPrefix(env, "PATH=") {
+			pathEnv = strings.TrimPrefix(env, "PATH=")
+		}
+	}
+	for _, dir := range filepath.SplitList(pathEnv) {
+		if len(dir) == 0 {
+			dir = "."
+		}
+		path := filepath.Join(dir, file)
+		if err := checkExecutable(path); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("Not found in PATH %s", pathEnv)
+}
+
+func checkExecutable(path string) error {
+	fileInfo, err := os.Stat(path)
 	if err != nil {
-		log.Errorf("LookPath error %v", err)
 		return err
 	}
-	log.Printf("Find path %s\n", path)
-	if err := syscall.Exec(path, cmdArr[0:], os.Environ()); err != nil {
-		log.Errorf("%s", err.Error())
+	if fileInfo.IsDir() || fileInfo.Mode()&0111 == 0 {
+		return fmt.Errorf("%s is not executable", path)
 	}
 
 	return nil
 }
 
-func readUserCommand() []string {
-	// 3 is the file descriptor after 0(stdin), 1(stdout) and 2(stderr).
-	pipe := os.NewFile(3, "pipe")
-	defer pipe.Close()
+// Resolve user[:group] to ids and the home directory with /etc/passwd and
+// /etc/group. The user is root if empty.
+// Ids need not exist in the files. The group defaults to the primary group
+// of the user.
+func lookupUser(user string) (int, int, string, error) {
+	if len(user) == 0 {
+		user = "0"
+	}
+	kv := strings.SplitN(user, ":", 2)
+
+	uid, gid, home := -1, 0, ""
+	// Each line is like root:x:0:0:root:/root:/bin/sh
+	if err := scanColonFile("/etc/passwd", func(fields []string) bool {
+		if len(fields) < 6 || (fields[0] != kv[0] && fields[2] != kv[0]) {
+			return false
+		}
+		uid, _ = strconv.Atoi(fields[2])
+		gid, _ = strconv.Atoi(fields[3])
+		home = fields[5]
+		return true
+	}); err != nil {
+		return 0, 0, "", err
+	}
+	if uid < 0 {
+		id, err := strconv.Atoi(kv[0])
+		if err != nil || id < 0 {
+			return 0, 0, "", fmt.Errorf("User %s not found in image", kv[0])
+		}
+		uid = id
+	}
+	if len(home) == 0 {
+		home = "/"
+		if uid == 0 {
+			home = "/root"
+		}
+	}
+
+	if len(kv) == 2 {
+		gid = -1
+		// Each line is like root:x:0:
+		if err := scanColonFile("/etc/group", func(fields []string) bool {
+			if len(fields) < 3 || (fields[0] != kv[1] && fields[2] != kv[1]) {
+				return false
+			}
+			gid, _ = strconv.Atoi(fields[2])
+			return true
+		}); err != nil {
+			return 0, 0, "", err
+		}
+		if gid < 0 {
+			id, err := strconv.Atoi(kv[1])
+			if err != nil || id < 0 {
+				return 0, 0, "", fmt.Errorf("Group %s not found in image", kv[1])
+			}
+			gid = id
+		}
+	}
 
-	msg, err := ioutil.ReadAll(pipe)
+	return uid, gid, home, nil
+}
+
+// Call match on the fields of each line until it returns true.
+// A missing file has no lines.
+func scanColonFile(filePath string, match func(fields []string) bool) error {
+	contentBytes, err := ioutil.ReadFile(filePath)
 	if err != nil {
-		log.Errorf("Init read pipe error %v", err)
-		return nil
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("ReadFile() %s error %v", filePath, err)
+	}
+	for _, line := range strings.Split(string(contentBytes), "\n") {
+		if match(strings.Split(line, ":")) {
+			return nil
+		}
 	}
-	msgStr := string(msg)
-	return strings.Split(msgStr, " ")
+
+	return nil
 }
 
-func mount() error {
+// Pivot to the root filesystem in the working directory and mount mounts in
+// it.
+func setupRootfs(mounts []Mount) error {
 	wd, err := os.Getwd()
 	if err != nil {
 		return fmt.Errorf("Get working directory error %v", err)
@@ -62,16 +249,13 @@ func mount() error {
 		return fmt.Errorf("pivotRoot() %s error %v", wd, err)
 	}
 
-	//_MS_NOEXEC: Do not allow program to be executed from this filesystem.
-	// MS_NO_SUID: Do not honor set-user-ID and set-group-ID bits or file capabilities when executing programs from this filesystem.
-	// MS_NODEV: Do not allow access to devices (special files) on this filesystem.
-	if err := syscall.Mount("proc", "/proc", "proc", syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV, ""); err != nil {
-		return fmt.Errorf("Mount() proc to /proc error %v", err)
-	}
-	// MS_STRICTATIME: Always update the last access time (atime) when files on this filesystem are accessed.
-	// MS_RELATIME: Only update atime if it is less than or equal to mtime or ctime. (default behaviour since Linux 2.6.20)
-	if err := syscall.Mount("tmpfs", "/dev", "tmpfs", syscall.MS_NOSUID | syscall.MS_STRICTATIME, "mode=755"); err != nil {
-		return fmt.Errorf("Mount() tmpfs to /dev error %v", err)
+	for _, m := range mounts {
+		if err := os.MkdirAll(m.Destination, 0755); err != nil {
+			return fmt.Errorf("MkdirAll() %s error %v", m.Destination, err)
+		}
+		if err := syscall.Mount(m.Source, m.Destination, m.Type, m.Flags, m.Data); err != nil {
+			return fmt.Errorf("Mount() %s to %s error %v", m.Source, m.Destination, err)
+		}
 	}
 
 	return nil
@@ -0,0 +1,165 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Bumped whenever InitConfig changes incompatibly.
+const INIT_CONFIG_VERSION = 1
+
+// Sent by the parent to the init process on fd 3 as a single JSON message.
+// The init process waits for it before it starts setting up the container.
+type InitConfig struct {
+	Version  int      `json:"version"`  // INIT_CONFIG_VERSION of the sender.
+	Args     []string `json:"args"`     // User command and its arguments.
+	Envs     []string `json:"envs"`     // Environment variables of the user command.
+	Cwd      string   `json:"cwd"`      // Working directory in the container.
+	Hostname string   `json:"hostname"` // Hostname in the UTS namespace.
+	User     string   `json:"user"`     // User of the form user[:group], names or ids.
+	Mounts   []Mount  `json:"mounts"`   // Mounted in order after pivot_root.
+	Rlimits  []Rlimit `json:"rlimits"`  // Resource limits of the user command.
+}
+
+type Mount struct {
+	Source      string  `json:"source"`
+	Destination string  `json:"destination"` // Absolute path in the container.
+	Type        string  `json:"type"`
+	Flags       uintptr `json:"flags"`
+	Data        string  `json:"data"`
+}
+
+type Rlimit struct {
+	Type int    `json:"type"` // Resource like syscall.RLIMIT_NOFILE.
+	Soft uint64 `json:"soft"`
+	Hard uint64 `json:"hard"`
+}
+
+// Written by the init process on fd 4 if it fails before executing the user
+// command. Nothing is written on success, since fd 4 is closed on exec.
+type InitResult struct {
+	Error string `json:"error"`
+}
+
+// Filesystems every container has.
+func DefaultMounts() []Mount {
+	return []Mount{
+		// MS_NOEXEC: Do not allow program to be executed from this filesystem.
+		// MS_NOSUID: Do not honor set-user-ID and set-group-ID bits or file capabilities when executing programs from this filesystem.
+		// MS_NODEV: Do not allow access to devices (special files) on this filesystem.
+		{
+			Source:      "proc",
+			Destination: "/proc",
+			Type:        "proc",
+			Flags:       syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV,
+		},
+		// MS_STRICTATIME: Always update the last access time (atime) when files on this filesystem are accessed.
+		{
+			Source:      "tmpfs",
+			Destination: "/dev",
+			Type:        "tmpfs",
+			Flags:       syscall.MS_NOSUID | syscall.MS_STRICTATIME,
+			Data:        "mode=755",
+		},
+	}
+}
+
+var rlimitTypes = map[string]int{
+	"core":    syscall.RLIMIT_CORE,
+	"cpu":     syscall.RLIMIT_CPU,
+	"data":    syscall.RLIMIT_DATA,
+	"fsize":   syscall.RLIMIT_FSIZE,
+	"nofile":  syscall.RLIMIT_NOFILE,
+	"stack":   syscall.RLIMIT_STACK,
+	"as":      syscall.RLIMIT_AS,
+	"nproc":   6,  // RLIMIT_NPROC
+	"memlock": 8,  // RLIMIT_MEMLOCK
+	"msgq":    12, // RLIMIT_MSGQUEUE
+}
+
+// Parse a resource limit of the form name=soft[:hard], like nofile=1024:2048.
+// The hard limit is the same as the soft limit if omitted.
+func ParseRlimit(spec string) (Rlimit, error) {
+	kv := strings.SplitN(spec, "=", 2)
+	if len(kv) != 2 {
+		return Rlimit{}, fmt.Errorf("Invalid ulimit %s", spec)
+	}
+	rlimitType, ok := rlimitTypes[kv[0]]
+	if !ok {
+		return Rlimit{}, fmt.Errorf("Unknown ulimit %s", kv[0])
+	}
+
+	limits := strings.SplitN(kv[1], ":", 2)
+	soft, err := strconv.ParseUint(limits[0], 10, 64)
+	if err != nil {
+		return Rlimit{}, fmt.Errorf("Invalid soft limit %s", limits[0])
+	}
+	hard := soft
+	if len(limits) == 2 {
+		if hard, err = strconv.ParseUint(limits[1], 10, 64); err != nil {
+			return Rlimit{}, fmt.Errorf("Invalid hard limit %s", limits[1])
+		}
+	}
+	if soft > hard {
+		return Rlimit{}, fmt.Errorf("Soft limit %d is greater than hard limit %d", soft, hard)
+	}
+
+	return Rlimit{Type: rlimitType, Soft: soft, Hard: hard}, nil
+}
+
+func WriteInitConfig(writer io.Writer, config *InitConfig) error {
+	jsonBytes, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("Marshal() %v error %v", config, err)
+	}
+	if _, err := writer.Write(jsonBytes); err != nil {
+		return fmt.Errorf("Write() init config error %v", err)
+	}
+
+	return nil
+}
+
+// Read the config until the parent closes the pipe.
+func ReadInitConfig(reader io.Reader) (*InitConfig, error) {
+	jsonBytes, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("ReadAll() init config error %v", err)
+	}
+
+	config := &InitConfig{}
+	if err := json.Unmarshal(jsonBytes, config); err != nil {
+		return nil, fmt.Errorf("Unmarshal() init config %s error %v", jsonBytes, err)
+	}
+	if config.Version != INIT_CONFIG_VERSION {
+		return nil, fmt.Errorf("Unsupported init config version %d, want %d", config.Version, INIT_CONFIG_VERSION)
+	}
+	if len(config.Args) == 0 {
+		return nil, fmt.Errorf("Empty user command")
+	}
+
+	return config, nil
+}
+
+// Wait until the init process executes the user command or fails.
+// EOF without a result means the user command is executed.
+func ReadInitResult(reader io.Reader) error {
+	jsonBytes, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("ReadAll() init result error %v", err)
+	}
+	if len(jsonBytes) == 0 {
+		return nil
+	}
+
+	result := &InitResult{}
+	if err := json.Unmarshal(jsonBytes, result); err != nil {
+		return fmt.Errorf("Unmarshal() init result %s error %v", jsonBytes, err)
+	}
+
+	return fmt.Errorf("%s", result.Error)
+}
@@ -0,0 +1,67 @@
+package container
+
+import (
+	"bytes"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestParseRlimit(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Rlimit
+		wantErr bool
+	}{
+		{"nofile=1024:2048", Rlimit{Type: syscall.RLIMIT_NOFILE, Soft: 1024, Hard: 2048}, false},
+		{"core=0", Rlimit{Type: syscall.RLIMIT_CORE}, false},
+		{"nofile=2048:1024", Rlimit{}, true},
+		{"unknown=1", Rlimit{}, true},
+		{"nofile", Rlimit{}, true},
+		{"nofile=x", Rlimit{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseRlimit(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseRlimit() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRlimit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInitConfig(t *testing.T) {
+	config := &InitConfig{
+		Version: INIT_CONFIG_VERSION,
+		Args:    []string{"sh", "-c", "echo hi there"},
+		Envs:    []string{"PATH=/bin"},
+		Mounts:  DefaultMounts(),
+	}
+	var buf bytes.Buffer
+	if err := WriteInitConfig(&buf, config); err != nil {
+		t.Fatalf("WriteInitConfig() error %v", err)
+	}
+	got, err := ReadInitConfig(&buf)
+	if err != nil {
+		t.Fatalf("ReadInitConfig() error %v", err)
+	}
+	if !reflect.DeepEqual(got, config) {
+		t.Errorf("ReadInitConfig() = %v, want %v", got, config)
+	}
+
+	if _, err := ReadInitConfig(bytes.NewBufferString(`{"version":0,"args":["sh"]}`)); err == nil {
+		t.Errorf("ReadInitConfig() of version 0 succeeds")
+	}
+
+	if err := ReadInitResult(&bytes.Buffer{}); err != nil {
+		t.Errorf("ReadInitResult() of EOF error %v", err)
+	}
+	err = ReadInitResult(bytes.NewBufferString(`{"error":"Executable x not found in image"}`))
+	if err == nil || err.Error() != "Executable x not found in image" {
+		t.Errorf("ReadInitResult() error %v", err)
+	}
+}
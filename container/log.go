@@ -0,0 +1,126 @@
+package container
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	LOG_STREAM_STDOUT = "stdout"
+	LOG_STREAM_STDERR = "stderr"
+
+	// This is a redefine outside package 'command',
+	// since Go does not support import cycle.
+	COMMAND_LOGGER = "logger"
+)
+
+// One line of the container log file.
+// The log file contains one JSON encoded entry per line.
+type LogEntry struct {
+	Log    string    `json:"log"`    // The line including the trailing '\n' if any.
+	Stream string    `json:"stream"` // stdout or stderr.
+	Time   time.Time `json:"time"`   // The time when the line is read.
+}
+
+// Create the pipes for stdout and stderr of the container and start a logger
+// process reading their read ends.
+// The returned write ends should be closed once they are inherited by the
+// container process, so that the logger can get EOF after the container exits.
+func startLogger(selfCmd, containerName string) (*os.File, *os.File, error) {
+	rStdout, wStdout, err := os.Pipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Pipe() error %v", err)
+	}
+	defer rStdout.Close()
+	rStderr, wStderr, err := os.Pipe()
+	if err != nil {
+		wStdout.Close()
+		return nil, nil, fmt.Errorf("Pipe() error %v", err)
+	}
+	defer rStderr.Close()
+	// The write ends are only returned on success.
+	closeWriteEnds := func() {
+		wStdout.Close()
+		wStderr.Close()
+	}
+
+	loggerCmd := exec.Command(selfCmd, COMMAND_LOGGER, containerName)
+	// Run in its own session so that it survives the dicker command.
+	loggerCmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid: true,
+	}
+	loggerCmd.ExtraFiles = []*os.File{
+		rStdout,
+		rStderr,
+	}
+	if err := loggerCmd.Start(); err != nil {
+		closeWriteEnds()
+		return nil, nil, fmt.Errorf("Start() logger process error %v", err)
+	}
+	// Nobody waits for the logger.
+	if err := loggerCmd.Process.Release(); err != nil {
+		// The logger gets EOF and exits.
+		closeWriteEnds()
+		return nil, nil, fmt.Errorf("Release() logger process error %v", err)
+	}
+
+	return wStdout, wStderr, nil
+}
+
+// Read stdout from fd 3 and stderr from fd 4 and append them to the
+// container log file until both of them get EOF.
+func RunContainerLogger(containerName string) error {
+	logFilePath := filepath.Join(DEFAULT_INFO_DIR_PATH, containerName, CONTAINER_LOG_FILE_NAME)
+	logFile, err := os.OpenFile(logFilePath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("OpenFile() %s error %v", logFilePath, err)
+	}
+	defer logFile.Close()
+
+	var mutex sync.Mutex
+	encoder := json.NewEncoder(logFile)
+	var wg sync.WaitGroup
+	streams := map[string]*os.File{
+		LOG_STREAM_STDOUT: os.NewFile(3, "stdout"),
+		LOG_STREAM_STDERR: os.NewFile(4, "stderr"),
+	}
+	for stream, pipe := range streams {
+		wg.Add(1)
+		go func(stream string, pipe *os.File) {
+			defer wg.Done()
+			defer pipe.Close()
+			copyLog(pipe, stream, encoder, &mutex)
+		}(stream, pipe)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// Encode every line read from reader as a LogEntry.
+func copyLog(reader io.Reader, stream string, encoder *json.Encoder, mutex *sync.Mutex) {
+	bufReader := bufio.NewReader(reader)
+	for {
+		line, err := bufReader.ReadString('\n')
+		if len(line) != 0 {
+			mutex.Lock()
+			encoder.Encode(&LogEntry{
+				Log:    line,
+				Stream: stream,
+				Time:   time.Now().UTC(),
+			})
+			mutex.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
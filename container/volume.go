@@ -2,16 +2,156 @@ package container
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 
 	log "github.com/sirupsen/logrus"
 )
 
-func NewWorkspace(volumeMapping , imageName, containerName string) error {
+const (
+	VOLUME_DRIVER_LOCAL = "local"
+	VOLUME_DRIVER_TMPFS = "tmpfs"
+	VOLUME_DRIVER_LOOP  = "loop"
+	// The ext4 image of a loop volume is kept next to its data directory.
+	LOOP_IMAGE_FILE_NAME = "disk.img"
+)
+
+const (
+	PROPAGATION_RPRIVATE = "rprivate"
+	PROPAGATION_RSHARED  = "rshared"
+	PROPAGATION_RSLAVE   = "rslave"
+)
+
+// Flag of umount2(2) missing in package syscall.
+const UMOUNT_NOFOLLOW = 0x8
+
+// Flags of statfs(2) kept when a mount is remounted read-only, and the mount
+// flags they correspond to.
+var statfsMountFlags = map[int64]uintptr{
+	0x2:    syscall.MS_NOSUID,     // ST_NOSUID
+	0x4:    syscall.MS_NODEV,      // ST_NODEV
+	0x8:    syscall.MS_NOEXEC,     // ST_NOEXEC
+	0x400:  syscall.MS_NOATIME,    // ST_NOATIME
+	0x800:  syscall.MS_NODIRATIME, // ST_NODIRATIME
+	0x1000: syscall.MS_RELATIME,   // ST_RELATIME
+}
+
+// A host path, a named volume or a tmpfs mounted into the container.
+type VolumeMount struct {
+	Name        string        `json:"name,omitempty"`    // Name of the volume, empty for a host path.
+	Source      string        `json:"source"`            // Absolute path on the host, empty for tmpfs.
+	Destination string        `json:"destination"`       // Absolute path in the container.
+	ReadOnly    bool          `json:"read_only"`         // Whether the container can only read it.
+	Propagation string        `json:"propagation"`       // One of rprivate, rshared and rslave.
+	Driver      string        `json:"driver,omitempty"`  // Driver providing the volume, local if empty.
+	Options     VolumeOptions `json:"options,omitempty"` // Options of the driver.
+	Created     bool          `json:"created,omitempty"` // Whether the host path is created by dicker.
+}
+
+type VolumeOptions struct {
+	Size int64  `json:"size,omitempty"` // Bytes, unlimited if 0 for tmpfs.
+	Mode uint32 `json:"mode,omitempty"` // Permission bits of the volume root, default if 0.
+}
+
+// A volume driver provides the storage of volumes and mounts them into
+// containers. Mounts are removed with the container mount point whatever the
+// driver is.
+type VolumeDriver interface {
+	// Check the options before a volume is created.
+	Validate(options VolumeOptions) error
+	// Prepare the storage of a named volume whose data directory is source.
+	Create(source string, options VolumeOptions) error
+	// Mount the volume at target, a path in the container filesystem.
+	Mount(m *VolumeMount, target string) error
+	// Release the storage of a named volume prepared by Create.
+	// The data directory is removed by the caller afterwards.
+	Remove(source string) error
+}
+
+var volumeDrivers = map[string]VolumeDriver{
+	VOLUME_DRIVER_LOCAL: localVolumeDriver{},
+	VOLUME_DRIVER_TMPFS: tmpfsVolumeDriver{},
+	VOLUME_DRIVER_LOOP:  loopVolumeDriver{},
+}
+
+// Return the driver called name, the local driver if name is empty.
+func GetVolumeDriver(name string) (VolumeDriver, error) {
+	if len(name) == 0 {
+		name = VOLUME_DRIVER_LOCAL
+	}
+	driver, ok := volumeDrivers[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown volume driver %s", name)
+	}
+
+	return driver, nil
+}
+
+var propagationFlags = map[string]uintptr{
+	PROPAGATION_RPRIVATE: syscall.MS_REC | syscall.MS_PRIVATE,
+	PROPAGATION_RSHARED:  syscall.MS_REC | syscall.MS_SHARED,
+	PROPAGATION_RSLAVE:   syscall.MS_REC | syscall.MS_SLAVE,
+}
+
+// Parse a volume of the form host:container[:ro|rw][,rprivate|rshared|rslave].
+// The volume is writable and rprivate by default.
+// A host part not being an absolute path is the name of a volume, whose
+// source should be filled in before the workspace is created.
+func ParseVolumeMount(spec string) (*VolumeMount, error) {
+	options := strings.Split(spec, ",")
+	fields := strings.Split(options[0], ":")
+	if len(fields) != 2 && len(fields) != 3 {
+		return nil, fmt.Errorf("Invalid volume %s", spec)
+	}
+
+	m := &VolumeMount{
+		Source:      fields[0],
+		Destination: fields[1],
+		Propagation: PROPAGATION_RPRIVATE,
+	}
+	if len(m.Source) == 0 {
+		return nil, fmt.Errorf("Invalid volume %s", spec)
+	}
+	if !filepath.IsAbs(m.Source) {
+		m.Name, m.Source = m.Source, ""
+	}
+	if !filepath.IsAbs(m.Destination) || filepath.Clean(m.Destination) == "/" {
+		return nil, fmt.Errorf("Invalid container path %s of volume %s", m.Destination, spec)
+	}
+	if len(m.Source) != 0 {
+		m.Source = filepath.Clean(m.Source)
+	}
+	m.Destination = filepath.Clean(m.Destination)
+
+	if len(fields) == 3 {
+		switch fields[2] {
+		case "ro":
+			m.ReadOnly = true
+		case "rw":
+		default:
+			return nil, fmt.Errorf("Unknown mode %s of volume %s", fields[2], spec)
+		}
+	}
+
+	for _, option := range options[1:] {
+		if _, ok := propagationFlags[option]; !ok {
+			return nil, fmt.Errorf("Unknown option %s of volume %s", option, spec)
+		}
+		m.Propagation = option
+	}
+
+	return m, nil
+}
+
+// Create the filesystem of the container from the image and bind the volumes
+// into it in order.
+// Everything created is deleted if any step fails.
+func NewWorkspace(mounts []*VolumeMount, imageName, containerName string) error {
 	if err := createReadOnlyLayer(imageName); err != nil {
 		return fmt.Errorf("createReadOnlyLayer() %s error %v", imageName, err)
 	}
@@ -19,56 +159,67 @@ func NewWorkspace(volumeMapping , imageName, containerName string) error {
 		return fmt.Errorf("createWriteLayer() %s error %v", containerName, err)
 	}
 	if err := createMountPoint(containerName, imageName); err != nil {
+		deleteWriteLayer(containerName)
 		return fmt.Errorf("createMountPoint() %s with %s error %v", containerName, imageName, err)
 	}
 
-	parentVolume, containerVolume, err := parseVolumeMapping(volumeMapping)
-	if err != nil {
-		log.Errorf("parseVolumeMapping() %s error %v", volumeMapping, err)
-	} else if len(parentVolume) != 0 && len(containerVolume) != 0 {
-		if err := mountVolume(parentVolume, containerVolume, containerName); err != nil {
-			log.Errorf("mountVolume() %s to %s error %v", parentVolume, containerVolume, containerName)
+	for i, m := range mounts {
+		if err := mountVolume(m, containerName); err != nil {
+			if err := DeleteWorkspace(mounts[:i], containerName); err != nil {
+				log.Errorf("DeleteWorkspace() %s error %v", containerName, err)
+			}
+			return fmt.Errorf("mountVolume() %s to %s error %v", m.Source, m.Destination, err)
 		}
 	}
 
 	return nil
 }
 
-func parseVolumeMapping(volumeMapping string) (string, string, error) {
-	if len(strings.TrimSpace(volumeMapping)) == 0 {
-		return "", "", nil
-	}
-	volumes := strings.Split(volumeMapping, string(os.PathListSeparator))
-	if len(volumes) != 2 || len(volumes[0]) == 0 || len(volumes[1]) == 0 {
-		return "", "", fmt.Errorf("Invalid volume mapping %s", volumeMapping)
-	}
-	return volumes[0], volumes[1], nil
-}
-
-// Untar image to ROOT_DIR_PATH/imageName
+// Untar image to READONLY_LAYER_DIR_PATH/imageName.
+// The image is extracted to a temporary directory first, so that a failed
+// extraction is never taken as a complete layer.
 func createReadOnlyLayer(imageName string) error {
 	imagePath := filepath.Join(IMAGE_DIR_PATH, imageName+".tar")
 	if _, err := os.Stat(imagePath); err != nil {
-		return fmt.Errorf("Stat() %s error %v", imagePath, err)	}
+		return fmt.Errorf("Stat() %s error %v", imagePath, err)
+	}
 
 	untarFoldPath := filepath.Join(READONLY_LAYER_DIR_PATH, imageName)
-	if _, err := os.Stat(untarFoldPath); err != nil {
-		if os.IsNotExist(err) {
-			// The directory needs creating.
-			// log.Infof("Directory %s needs creating", untarFoldPath)
-			if err := os.MkdirAll(untarFoldPath, 0622); err != nil {
-				return fmt.Errorf("MkdirAll() %s error %v", untarFoldPath, err)
-			}
-			// After creating the directory, untar the image.
-			if _, err := exec.Command("tar", "-xvf", imagePath, "-C", untarFoldPath).CombinedOutput(); err != nil {
-				return fmt.Errorf("Untar %s to directory %s error %v", imagePath, untarFoldPath, err)
-			}
-		} else {
-			return fmt.Errorf("Stat() %s exists error %v", untarFoldPath, err)
+	if _, err := os.Stat(untarFoldPath); err == nil {
+		// Already exists. No operation needed.
+		return nil
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("Stat() %s exists error %v", untarFoldPath, err)
+	}
+
+	tmpFoldPath := fmt.Sprintf("%s.%d.tmp", untarFoldPath, os.Getpid())
+	if err := untarImage(imagePath, tmpFoldPath); err != nil {
+		os.RemoveAll(tmpFoldPath)
+		return fmt.Errorf("untarImage() %s to %s error %v", imagePath, tmpFoldPath, err)
+	}
+	if err := os.Rename(tmpFoldPath, untarFoldPath); err != nil {
+		os.RemoveAll(tmpFoldPath)
+		// Another container may have extracted the same image meanwhile.
+		if _, statErr := os.Stat(untarFoldPath); statErr == nil {
+			return nil
 		}
+		return fmt.Errorf("Rename() %s to %s error %v", tmpFoldPath, untarFoldPath, err)
+	}
+
+	return nil
+}
+
+func untarImage(imagePath, dirPath string) error {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return fmt.Errorf("Open() %s error %v", imagePath, err)
+	}
+	defer f.Close()
+
+	if err := ExtractTar(f, dirPath); err != nil {
+		return fmt.Errorf("ExtractTar() %s error %v", imagePath, err)
 	}
 
-	// Already exists. No operation needed.
 	return nil
 }
 
@@ -106,45 +257,400 @@ func createMountPoint(containerName, imageName string) error {
 	return nil
 }
 
-// Mount parentVolume to MNT_DIR_PATH/containerName/containerVolume.
-func mountVolume(parentVolume, containerVolume, containerName string) error {
-	// Create the host directory.
-	if err := os.MkdirAll(parentVolume, 0777); err != nil {
-		return fmt.Errorf("Mkdir() %s error %v", parentVolume, err)
+// Mount the volume at MNT_DIR_PATH/containerName/m.Destination with its driver.
+func mountVolume(m *VolumeMount, containerName string) error {
+	driver, err := GetVolumeDriver(m.Driver)
+	if err != nil {
+		return fmt.Errorf("GetVolumeDriver() %s error %v", m.Driver, err)
+	}
+
+	containerVolumePath, err := volumeTarget(m.Destination, containerName)
+	if err != nil {
+		return fmt.Errorf("volumeTarget() %s error %v", m.Destination, err)
+	}
+	// Mounting follows a symlink, which may point anywhere on the host.
+	if info, err := os.Lstat(containerVolumePath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("Container path %s is a symlink", m.Destination)
+	}
+	if err := driver.Mount(m, containerVolumePath); err != nil {
+		return fmt.Errorf("Mount() %s with driver %s error %v", containerVolumePath, m.Driver, err)
 	}
 
+	return nil
+}
+
+// Return the mount point of a volume at destination in the container, under
+// MNT_DIR_PATH/containerName.
+// The directories of destination are resolved in the container filesystem,
+// so symlinks in the image never lead the mount out of it.
+func volumeTarget(destination, containerName string) (string, error) {
 	mntPath := filepath.Join(MNT_DIR_PATH, containerName)
-	// /root/mnt/containerName/containerVolume is the mount point.
-	// It is in the container filesystem.
-	containerVolumePath := filepath.Join(mntPath, containerVolume)
-	if err := os.MkdirAll(containerVolumePath, 0777); err != nil {
-		return fmt.Errorf("Mkdir() %s error %v", containerVolumePath, err)
+	dir, base := filepath.Split(filepath.Clean("/" + destination))
+	parent, err := secureJoin(mntPath, dir)
+	if err != nil {
+		return "", fmt.Errorf("secureJoin() %s error %v", dir, err)
+	}
+
+	return filepath.Join(parent, base), nil
+}
+
+// Bind m.Source to target, which is created like m.Source.
+func bindVolume(m *VolumeMount, target string) error {
+	sourceInfo, err := os.Stat(m.Source)
+	if err != nil {
+		return fmt.Errorf("Stat() %s error %v", m.Source, err)
+	}
+
+	// A file can only be bound to a file.
+	if sourceInfo.IsDir() {
+		if err := os.MkdirAll(target, 0777); err != nil {
+			return fmt.Errorf("MkdirAll() %s error %v", target, err)
+		}
+	} else {
+		if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+			return fmt.Errorf("MkdirAll() %s error %v", filepath.Dir(target), err)
+		}
+		f, err := os.OpenFile(target, os.O_CREATE, 0644)
+		if err != nil {
+			return fmt.Errorf("OpenFile() %s error %v", target, err)
+		}
+		f.Close()
+	}
+
+	// Like docker, an empty named volume is seeded from the image.
+	if len(m.Name) != 0 && sourceInfo.IsDir() {
+		if err := seedVolume(target, m.Source); err != nil {
+			return fmt.Errorf("seedVolume() %s from %s error %v", m.Name, target, err)
+		}
+	}
+
+	// Bind m.Source to target.
+	if err := syscall.Mount(m.Source, target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("Mount() %s to %s error %v", m.Source, target, err)
+	}
+	// The flags other than MS_BIND and MS_REC are ignored when binding, so
+	// read-only needs a remount.
+	if m.ReadOnly {
+		if err := remountReadOnly(target); err != nil {
+			unmountIfMounted(target)
+			return fmt.Errorf("remountReadOnly() %s error %v", target, err)
+		}
+	}
+
+	return setPropagation(m, target)
+}
+
+// Remount the mount at target and every mount under it read-only, since a
+// remount only changes a single mount.
+func remountReadOnly(target string) error {
+	mountPoints, err := mountPointsUnder(target)
+	if err != nil {
+		return fmt.Errorf("mountPointsUnder() %s error %v", target, err)
+	}
+
+	for _, mountPoint := range mountPoints {
+		var statfs syscall.Statfs_t
+		if err := syscall.Statfs(mountPoint, &statfs); err != nil {
+			return fmt.Errorf("Statfs() %s error %v", mountPoint, err)
+		}
+		// A remount clears the flags not given again.
+		flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY)
+		for stFlag, msFlag := range statfsMountFlags {
+			if statfs.Flags&stFlag != 0 {
+				flags |= msFlag
+			}
+		}
+		if err := syscall.Mount("", mountPoint, "", flags, ""); err != nil {
+			return fmt.Errorf("Mount() %s read-only error %v", mountPoint, err)
+		}
+	}
+
+	return nil
+}
+
+// Return target and the mount points under it in /proc/self/mountinfo, with
+// parents before their children.
+func mountPointsUnder(target string) ([]string, error) {
+	contentBytes, err := ioutil.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return nil, fmt.Errorf("ReadFile() /proc/self/mountinfo error %v", err)
+	}
+
+	// The mount point is the fifth field, like
+	// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw
+	var mountPoints []string
+	seen := map[string]bool{}
+	for _, line := range strings.Split(string(contentBytes), "\n") {
+		fields := strings.Split(line, " ")
+		if len(fields) < 5 {
+			continue
+		}
+		mountPoint := unescapeMountInfo(fields[4])
+		if mountPoint != target && !strings.HasPrefix(mountPoint, target+"/") {
+			continue
+		}
+		if !seen[mountPoint] {
+			seen[mountPoint] = true
+			mountPoints = append(mountPoints, mountPoint)
+		}
+	}
+
+	return mountPoints, nil
+}
+
+// Decode the octal escapes like \040 of space in /proc/self/mountinfo.
+func unescapeMountInfo(field string) string {
+	var buf strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+3 < len(field) {
+			if c, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				buf.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		buf.WriteByte(field[i])
+	}
+
+	return buf.String()
+}
+
+// Change the propagation type of the mount at target, and unmount it if
+// that fails.
+func setPropagation(m *VolumeMount, target string) error {
+	propagation := m.Propagation
+	if len(propagation) == 0 {
+		propagation = PROPAGATION_RPRIVATE
+	}
+	if err := syscall.Mount("", target, "", propagationFlags[propagation], ""); err != nil {
+		unmountIfMounted(target)
+		return fmt.Errorf("Mount() %s %s error %v", target, propagation, err)
+	}
+
+	return nil
+}
+
+// Bind a host directory or file, which is created as a directory if it
+// does not exist.
+type localVolumeDriver struct{}
+
+func (localVolumeDriver) Validate(options VolumeOptions) error {
+	if options != (VolumeOptions{}) {
+		return fmt.Errorf("Volume driver %s takes no options", VOLUME_DRIVER_LOCAL)
+	}
+
+	return nil
+}
+
+func (localVolumeDriver) Create(source string, options VolumeOptions) error {
+	return nil
+}
+
+func (localVolumeDriver) Mount(m *VolumeMount, target string) error {
+	if _, err := os.Stat(m.Source); os.IsNotExist(err) {
+		if err := os.MkdirAll(m.Source, 0777); err != nil {
+			return fmt.Errorf("MkdirAll() %s error %v", m.Source, err)
+		}
+		// Only what dicker creates is deleted with the container.
+		m.Created = true
+	}
+
+	return bindVolume(m, target)
+}
+
+func (localVolumeDriver) Remove(source string) error {
+	return nil
+}
+
+// Mount a new tmpfs for every container, so the data is neither shared nor
+// kept after the container is removed.
+type tmpfsVolumeDriver struct{}
+
+func (tmpfsVolumeDriver) Validate(options VolumeOptions) error {
+	if options.Size < 0 {
+		return fmt.Errorf("Invalid size %d of volume driver %s", options.Size, VOLUME_DRIVER_TMPFS)
+	}
+	if options.Mode&^07777 != 0 {
+		return fmt.Errorf("Invalid mode %o of volume driver %s", options.Mode, VOLUME_DRIVER_TMPFS)
+	}
+
+	return nil
+}
+
+func (tmpfsVolumeDriver) Create(source string, options VolumeOptions) error {
+	return nil
+}
+
+func (tmpfsVolumeDriver) Mount(m *VolumeMount, target string) error {
+	if err := os.MkdirAll(target, 0777); err != nil {
+		return fmt.Errorf("MkdirAll() %s error %v", target, err)
+	}
+
+	var data []string
+	if m.Options.Size != 0 {
+		data = append(data, fmt.Sprintf("size=%d", m.Options.Size))
+	}
+	if m.Options.Mode != 0 {
+		data = append(data, fmt.Sprintf("mode=%o", m.Options.Mode))
+	}
+	flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV)
+	if m.ReadOnly {
+		flags |= syscall.MS_RDONLY
+	}
+	if err := syscall.Mount("tmpfs", target, "tmpfs", flags, strings.Join(data, ",")); err != nil {
+		return fmt.Errorf("Mount() tmpfs to %s with options %v error %v", target, data, err)
+	}
+
+	return setPropagation(m, target)
+}
+
+func (tmpfsVolumeDriver) Remove(source string) error {
+	return nil
+}
+
+// Format a sparse file of the given size as ext4, and loop-mount it on the
+// data directory of the volume, which is then bound like a local volume.
+// The image stays mounted on the host until the volume is removed, so that
+// containers share one mount of the filesystem.
+type loopVolumeDriver struct{}
+
+func (loopVolumeDriver) Validate(options VolumeOptions) error {
+	if options.Size <= 0 {
+		return fmt.Errorf("Volume driver %s requires a size", VOLUME_DRIVER_LOOP)
+	}
+	if options.Mode&^07777 != 0 {
+		return fmt.Errorf("Invalid mode %o of volume driver %s", options.Mode, VOLUME_DRIVER_LOOP)
+	}
+
+	return nil
+}
+
+func (d loopVolumeDriver) Create(source string, options VolumeOptions) error {
+	imagePath := filepath.Join(filepath.Dir(source), LOOP_IMAGE_FILE_NAME)
+	f, err := os.OpenFile(imagePath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("OpenFile() %s error %v", imagePath, err)
+	}
+	// Truncating does not allocate any block.
+	err = f.Truncate(options.Size)
+	f.Close()
+	if err != nil {
+		os.Remove(imagePath)
+		return fmt.Errorf("Truncate() %s to %d error %v", imagePath, options.Size, err)
+	}
+	if output, err := exec.Command("mkfs.ext4", "-q", "-F", imagePath).CombinedOutput(); err != nil {
+		os.Remove(imagePath)
+		return fmt.Errorf("Format %s as ext4 error %v: %s", imagePath, err, output)
+	}
+
+	if err := d.mountImage(source); err != nil {
+		os.Remove(imagePath)
+		return fmt.Errorf("mountImage() %s error %v", source, err)
+	}
+	// Start empty so that the volume is seeded from the image on first use.
+	lostFoundPath := filepath.Join(source, "lost+found")
+	if err := os.Remove(lostFoundPath); err != nil && !os.IsNotExist(err) {
+		d.Remove(source)
+		return fmt.Errorf("Remove() %s error %v", lostFoundPath, err)
+	}
+	if options.Mode != 0 {
+		if err := os.Chmod(source, os.FileMode(options.Mode)); err != nil {
+			d.Remove(source)
+			return fmt.Errorf("Chmod() %s to %o error %v", source, options.Mode, err)
+		}
+	}
+
+	return nil
+}
+
+func (d loopVolumeDriver) Mount(m *VolumeMount, target string) error {
+	if err := d.mountImage(m.Source); err != nil {
+		return fmt.Errorf("mountImage() %s error %v", m.Source, err)
+	}
+
+	return bindVolume(m, target)
+}
+
+func (loopVolumeDriver) Remove(source string) error {
+	if err := unmountIfMounted(source); err != nil {
+		return fmt.Errorf("unmountIfMounted() %s error %v", source, err)
+	}
+	imagePath := filepath.Join(filepath.Dir(source), LOOP_IMAGE_FILE_NAME)
+	if err := os.Remove(imagePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Remove() %s error %v", imagePath, err)
+	}
+
+	return nil
+}
+
+// Loop-mount the image on source unless it is mounted, like after a reboot.
+// The loop device is freed automatically when source is unmounted.
+func (loopVolumeDriver) mountImage(source string) error {
+	mounted, err := isMountPoint(source)
+	if err != nil {
+		return fmt.Errorf("isMountPoint() %s error %v", source, err)
+	}
+	if mounted {
+		return nil
+	}
+
+	imagePath := filepath.Join(filepath.Dir(source), LOOP_IMAGE_FILE_NAME)
+	if output, err := exec.Command("mount", "-t", "ext4", "-o", "loop", imagePath, source).CombinedOutput(); err != nil {
+		return fmt.Errorf("Mount %s to %s error %v: %s", imagePath, source, err, output)
+	}
+
+	return nil
+}
+
+// A directory is a mount point if it is on another device than its parent.
+func isMountPoint(path string) (bool, error) {
+	var stat, parentStat syscall.Stat_t
+	if err := syscall.Stat(path, &stat); err != nil {
+		return false, fmt.Errorf("Stat() %s error %v", path, err)
+	}
+	if err := syscall.Stat(filepath.Dir(path), &parentStat); err != nil {
+		return false, fmt.Errorf("Stat() %s error %v", filepath.Dir(path), err)
 	}
 
-	// Bind parentVolume to containerVolumePath.
-	if err := syscall.Mount(parentVolume, containerVolumePath, "", syscall.MS_BIND | syscall.MS_REC, ""); err != nil {
-		return fmt.Errorf("Mount() %s to %s error %v", parentVolume, containerVolumePath, err)
+	return stat.Dev != parentStat.Dev, nil
+}
+
+// Copy the contents of the directory src to dst if dst is empty, keeping the
+// ownership, modes and links.
+func seedVolume(src, dst string) error {
+	dstInfos, err := ioutil.ReadDir(dst)
+	if err != nil {
+		return fmt.Errorf("ReadDir() %s error %v", dst, err)
+	}
+	srcInfos, err := ioutil.ReadDir(src)
+	if err != nil {
+		return fmt.Errorf("ReadDir() %s error %v", src, err)
+	}
+	if len(dstInfos) != 0 || len(srcInfos) == 0 {
+		return nil
+	}
+
+	if err := copyTree(src, dst); err != nil {
+		return fmt.Errorf("copyTree() %s to %s error %v", src, dst, err)
 	}
+
 	return nil
 }
 
-// Delete containerVolume, container mount point and additional layers.
+// Unmount the volumes in reverse order, and delete the container mount point
+// and additional layers.
 // Return non-nil if any practical deletion operation fails
 // and the return value is the last occurred error.
-func DeleteWorkspace(volumeMapping, containerName string) error {
+func DeleteWorkspace(mounts []*VolumeMount, containerName string) error {
 	var retErr error
-	parentVolume, containerVolume, err := parseVolumeMapping(volumeMapping)
-	if err != nil {
-		log.Errorf("parseVolumeMapping() %s error %v", volumeMapping, err)
-		// Just continue. But if there is really a volume mounted,
-		// the unmounting operation of the container mount point will fail.
-	} else if len(parentVolume) != 0 && len(containerVolume) != 0 {
-		if err := deleteVolume(containerVolume, containerName); err != nil {
-			retErr = fmt.Errorf("deleteVolume() %s from %s error %v.", containerVolume, containerName, err)
+	// A volume may be mounted on another one.
+	for i := len(mounts) - 1; i >= 0; i-- {
+		if err := deleteVolume(mounts[i].Destination, containerName); err != nil {
+			retErr = fmt.Errorf("deleteVolume() %s from %s error %v.", mounts[i].Destination, containerName, err)
 			log.Error(retErr.Error())
 		}
 	}
-	
+
 	if err := deleteMountPoint(containerName); err != nil {
 		retErr = fmt.Errorf("deleteMountPoint() %s error %v", containerName, err)
 		log.Error(retErr.Error())
@@ -157,14 +663,39 @@ func DeleteWorkspace(volumeMapping, containerName string) error {
 	return retErr
 }
 
+// Delete the host directories of the volumes created by dicker when the
+// container was run. Host paths given by the user and named volumes are kept.
+// This must be done after the volumes are unmounted from the container.
+func DeleteVolumeData(mounts []*VolumeMount) error {
+	for _, m := range mounts {
+		if !m.Created || len(m.Name) != 0 || (len(m.Driver) != 0 && m.Driver != VOLUME_DRIVER_LOCAL) {
+			continue
+		}
+		if filepath.Clean(m.Source) == "/" {
+			return fmt.Errorf("Refuse to delete host volume %s", m.Source)
+		}
+		if err := os.RemoveAll(m.Source); err != nil {
+			return fmt.Errorf("RemoveAll() %s error %v", m.Source, err)
+		}
+	}
+
+	return nil
+}
+
 // Delete containerVolume from containerName.
 // This must be done before deleting the container mount point.
 // Or the system will warn the target is busy.
 func deleteVolume(containerVolume, containerName string) error {
-	mntPath := filepath.Join(MNT_DIR_PATH, containerName)
-	containerVolumePath := filepath.Join(mntPath, containerVolume)
-	if err := syscall.Unmount(containerVolumePath, 0); err != nil {
-		return fmt.Errorf("Unmount() %s error %v", containerVolumePath, err)
+	containerVolumePath, err := volumeTarget(containerVolume, containerName)
+	if err != nil {
+		return fmt.Errorf("volumeTarget() %s error %v", containerVolume, err)
+	}
+	// Nothing is mounted on a symlink, and unmounting would follow it.
+	if info, err := os.Lstat(containerVolumePath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+	if err := unmountIfMounted(containerVolumePath); err != nil {
+		return fmt.Errorf("unmountIfMounted() %s error %v", containerVolumePath, err)
 	}
 
 	return nil
@@ -172,8 +703,8 @@ func deleteVolume(containerVolume, containerName string) error {
 
 func deleteMountPoint(containerName string) error {
 	mntPath := filepath.Join(MNT_DIR_PATH, containerName)
-	if err := syscall.Unmount(mntPath, 0); err != nil {
-		return fmt.Errorf("Unmount() %s error %v", mntPath, err)
+	if err := unmountIfMounted(mntPath); err != nil {
+		return fmt.Errorf("unmountIfMounted() %s error %v", mntPath, err)
 	}
 	if err := os.RemoveAll(mntPath); err != nil {
 		return fmt.Errorf("RemoveAll() %s error %v", mntPath, err)
@@ -196,3 +727,20 @@ func deleteWriteLayer(containerName string) error {
 
 	return nil
 }
+
+// Unmount target, it is not an error if target does not exist
+// or is not a mount point, so that the workspace can be deleted twice.
+// The mounts under target are detached with it, like those of a recursive
+// bind, and a symlink at target is never followed.
+func unmountIfMounted(target string) error {
+	if err := syscall.Unmount(target, syscall.MNT_DETACH|UMOUNT_NOFOLLOW); err != nil {
+		// EINVAL: target is not a mount point.
+		// ENOENT: target does not exist.
+		if err == syscall.EINVAL || err == syscall.ENOENT {
+			return nil
+		}
+		return fmt.Errorf("Unmount() %s error %v", target, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package container
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVolumeMount(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    *VolumeMount
+		wantErr bool
+	}{
+		{"/host:/data", &VolumeMount{Source: "/host", Destination: "/data", Propagation: PROPAGATION_RPRIVATE}, false},
+		{"/host/:/data/:ro", &VolumeMount{Source: "/host", Destination: "/data", ReadOnly: true, Propagation: PROPAGATION_RPRIVATE}, false},
+		{"/host:/data:rw,rslave", &VolumeMount{Source: "/host", Destination: "/data", Propagation: PROPAGATION_RSLAVE}, false},
+		{"/host:/data,rshared", &VolumeMount{Source: "/host", Destination: "/data", Propagation: PROPAGATION_RSHARED}, false},
+		{"/host", nil, true},
+		{"myvol:/data:ro", &VolumeMount{Name: "myvol", Destination: "/data", ReadOnly: true, Propagation: PROPAGATION_RPRIVATE}, false},
+		{":/data", nil, true},
+		{"/host:data", nil, true},
+		{"/host:/", nil, true},
+		{"/host:/data:rx", nil, true},
+		{"/host:/data:ro,shared", nil, true},
+		{"/host:/data:ro:rw", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseVolumeMount(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseVolumeMount() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseVolumeMount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_unescapeMountInfo(t *testing.T) {
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{"/mnt/data", "/mnt/data"},
+		{"/mnt/my\\040data", "/mnt/my data"},
+		{"/mnt/a\\134b", "/mnt/a\\b"},
+		{"/mnt/a\\04", "/mnt/a\\04"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			if got := unescapeMountInfo(tt.field); got != tt.want {
+				t.Errorf("unescapeMountInfo() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"github.com/chengzeyi/dicker/command"
+	// Enter the container namespaces for 'dicker exec' before the Go runtime starts.
+	_ "github.com/chengzeyi/dicker/nsenter"
 	"os"
 
 	log "github.com/sirupsen/logrus"
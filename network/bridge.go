@@ -94,7 +94,21 @@ func (b *BridgeNetworkDriver) ConnectToNetwork(nw *Network, endpoint *Endpoint)
 
 // Disconnect the endpoint from the network.
 func (b *BridgeNetworkDriver) DisconnectFromNetwork(nw *Network, endpoint *Endpoint) error {
-	panic("not implemented")
+	// The name must be less than 16 characters.
+	vethName := endpoint.Id[:8]
+	veth, err := netlink.LinkByName(vethName)
+	if err != nil {
+		// The veth pair is destroyed together with the net namespace
+		// of the container, so there may be nothing to delete.
+		log.Warnf("LinkByName() veth %s error %v", vethName, err)
+		return nil
+	}
+
+	if err := netlink.LinkDel(veth); err != nil {
+		return fmt.Errorf("LinkDel() veth %s error %v", vethName, err)
+	}
+
+	return nil
 }
 
 // Create a new network bridge interface with bridgeName as its name.
@@ -20,6 +20,8 @@ const (
 var (
 	drivers  = map[string]NetworkDriver{}
 	networks = map[string]*Network{}
+
+	bridgeDriver = &BridgeNetworkDriver{}
 )
 
 type Endpoint struct {
@@ -114,7 +116,7 @@ func (n *Network) Load(path string) error {
 }
 
 func Init() error {
-	// TODO: init network drivers.
+	drivers[bridgeDriver.Name()] = bridgeDriver
 
 	if _, err := os.Stat(DEFAULT_NETWORK_PATH); err != nil {
 		if os.IsNotExist(err) {
@@ -244,9 +246,44 @@ func ConnectToNetwork(nwName string, containerInfo *container.ContainerInfo) err
 	// configEndpoint
 	// configPortMappings
 
+	// Record the endpoint so that it can be released on removal.
+	containerInfo.Network = nwName
+	containerInfo.Ip = ip
+
 	return nil
 }
 
+// Disconnect the container from the network and release its IP address.
 func DisconnectFromNetwork(nwName string, containerInfo *container.ContainerInfo) error {
-	panic("not implemented")
+	nw, ok := networks[nwName]
+	if !ok {
+		return fmt.Errorf("Network %s not exists", nwName)
+	}
+
+	nwDriver, ok := drivers[nw.Driver]
+	if !ok {
+		return fmt.Errorf("Driver %s not exists", nw.Driver)
+	}
+
+	endpoint := &Endpoint{
+		Id: fmt.Sprintf("%s-%s", containerInfo.Id, nwName),
+		Ip: containerInfo.Ip,
+		Network: nw,
+		PortMappings: containerInfo.PortMappings,
+	}
+
+	if err := nwDriver.DisconnectFromNetwork(nw, endpoint); err != nil {
+		return fmt.Errorf("DisconnectFromNetwork() %s error %v", nw.Name, err)
+	}
+
+	if containerInfo.Ip != nil {
+		if err := ipAllocator.Release(nw.Subnet, containerInfo.Ip); err != nil {
+			return fmt.Errorf("Release() %v in %s error %v", containerInfo.Ip, nw.Subnet, err)
+		}
+	}
+
+	containerInfo.Network = ""
+	containerInfo.Ip = nil
+
+	return nil
 }
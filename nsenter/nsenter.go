@@ -0,0 +1,160 @@
+// Package nsenter enters the namespaces of a running container before the Go
+// runtime starts.
+//
+// setns(2) on a mount namespace fails in a multithreaded process, and the Go
+// runtime is always multithreaded, so this has to be done in a C constructor.
+// The constructor does nothing unless DICKER_EXEC_PID is set, so importing
+// this package has no effect on other commands.
+//
+// When DICKER_EXEC_PID is set, the process is expected to be started as
+// '<self> exec <COMMAND> [ARG]...' with a sync pipe on fd 3. The constructor
+// waits for the pipe to be closed by the parent, which joins this process to
+// the container cgroups in the meantime, then enters the namespaces of the
+// pid, forks and executes the command. It exits with the exit code of the
+// command and never returns to the Go runtime.
+package nsenter
+
+/*
+#define _GNU_SOURCE
+#include <errno.h>
+#include <fcntl.h>
+#include <sched.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#define EXEC_PID_ENV "DICKER_EXEC_PID"
+#define EXEC_WORKDIR_ENV "DICKER_EXEC_WORKDIR"
+#define EXEC_SYNC_FD 3
+// Exit code of the failures inside the constructor, like docker exec.
+#define EXEC_FAILED_CODE 126
+
+// The mount namespace must be the last one, since /proc of the host is no
+// longer visible after entering it.
+static const char *namespaces[] = {"ipc", "uts", "net", "pid", "mnt"};
+
+// Read /proc/self/cmdline into a NULL terminated argument array.
+static char **read_cmdline(int *argc) {
+	int fd = open("/proc/self/cmdline", O_RDONLY);
+	if (fd < 0) {
+		return NULL;
+	}
+
+	size_t cap = 4096, len = 0;
+	char *buf = malloc(cap);
+	for (;;) {
+		if (len == cap) {
+			cap *= 2;
+			buf = realloc(buf, cap);
+		}
+		ssize_t n = read(fd, buf + len, cap - len);
+		if (n < 0) {
+			close(fd);
+			return NULL;
+		}
+		if (n == 0) {
+			break;
+		}
+		len += n;
+	}
+	close(fd);
+
+	int n = 0;
+	for (size_t i = 0; i < len; i++) {
+		if (buf[i] == '\0') {
+			n++;
+		}
+	}
+	char **argv = calloc(n + 1, sizeof(char *));
+	char *p = buf;
+	for (int i = 0; i < n; i++) {
+		argv[i] = p;
+		p += strlen(p) + 1;
+	}
+	*argc = n;
+
+	return argv;
+}
+
+__attribute__((constructor)) static void enter_namespaces(void) {
+	char *pid = getenv(EXEC_PID_ENV);
+	if (pid == NULL || strlen(pid) == 0) {
+		return;
+	}
+
+	// Wait for the parent to join this process to the container cgroups.
+	char c;
+	while (read(EXEC_SYNC_FD, &c, 1) < 0 && errno == EINTR) {
+	}
+	close(EXEC_SYNC_FD);
+
+	int argc;
+	char **argv = read_cmdline(&argc);
+	// argv is '<self> exec <COMMAND> [ARG]...'.
+	if (argv == NULL || argc < 3) {
+		fprintf(stderr, "nsenter: missing command\n");
+		exit(EXEC_FAILED_CODE);
+	}
+
+	for (size_t i = 0; i < sizeof(namespaces) / sizeof(namespaces[0]); i++) {
+		char nsPath[64];
+		snprintf(nsPath, sizeof(nsPath), "/proc/%s/ns/%s", pid, namespaces[i]);
+		int fd = open(nsPath, O_RDONLY);
+		if (fd < 0) {
+			fprintf(stderr, "nsenter: open %s error %s\n", nsPath, strerror(errno));
+			exit(EXEC_FAILED_CODE);
+		}
+		if (setns(fd, 0) < 0) {
+			fprintf(stderr, "nsenter: setns %s error %s\n", nsPath, strerror(errno));
+			exit(EXEC_FAILED_CODE);
+		}
+		close(fd);
+	}
+
+	char *workdir = getenv(EXEC_WORKDIR_ENV);
+	if (workdir == NULL || strlen(workdir) == 0) {
+		workdir = "/";
+	}
+	if (chdir(workdir) < 0) {
+		fprintf(stderr, "nsenter: chdir %s error %s\n", workdir, strerror(errno));
+		exit(EXEC_FAILED_CODE);
+	}
+	unsetenv(EXEC_PID_ENV);
+	unsetenv(EXEC_WORKDIR_ENV);
+
+	// Only the children are in the entered pid namespace.
+	pid_t child = fork();
+	if (child < 0) {
+		fprintf(stderr, "nsenter: fork error %s\n", strerror(errno));
+		exit(EXEC_FAILED_CODE);
+	}
+	if (child == 0) {
+		execvp(argv[2], argv + 2);
+		fprintf(stderr, "nsenter: exec %s error %s\n", argv[2], strerror(errno));
+		// Exit code of command not found, like shells.
+		exit(errno == ENOENT ? 127 : EXEC_FAILED_CODE);
+	}
+
+	int status;
+	while (waitpid(child, &status, 0) < 0) {
+		if (errno != EINTR) {
+			fprintf(stderr, "nsenter: waitpid error %s\n", strerror(errno));
+			exit(EXEC_FAILED_CODE);
+		}
+	}
+	if (WIFSIGNALED(status)) {
+		exit(128 + WTERMSIG(status));
+	}
+	exit(WEXITSTATUS(status));
+}
+*/
+import "C"
+
+const (
+	// Keep them the same as the C definitions above.
+	EXEC_PID_ENV     = "DICKER_EXEC_PID"
+	EXEC_WORKDIR_ENV = "DICKER_EXEC_WORKDIR"
+)
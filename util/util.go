@@ -4,11 +4,15 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
+	"math/big"
 	"math/rand"
-	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/chengzeyi/dicker/container"
@@ -56,52 +60,103 @@ func GetEnvsByPid(pid string) []string {
 	return envs
 }
 
-// Find the root mount point of the cgroup subsystem.
-func FindCgroupMountPoint(subsystem string) string {
-	// This file contains information about mount points in the process's mount
-	// namespace. It supplies various information.
-	f, err := os.Open("/proc/self/mountinfo")
-	if err != nil {
-		log.Errorf("Open() /proc/self/mountinfo error %v", err)
-		return ""
-	}
-	defer f.Close()
-
-	// Baseic format is:
-	// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
-	// (1)(2)(3)   (4)   (5)      (6)      (7)   (8) (9)   (10)         (11)
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		text := scanner.Text()
-		fields := strings.Split(text, " ")
-		for _, opt := range strings.Split(fields[len(fields)-1], ",") {
-			if opt == subsystem {
-				// Mount point: the pathname of the mount point relative to the
-				// process's root directory.
-				return fields[4]
+// Parse environment variables in the dotenv syntax, one per line like
+// KEY=VALUE or export KEY="VALUE". Blank lines and lines starting with # are
+// ignored. A line with only KEY is returned as is, for the caller to look it up.
+func ParseEnvFile(reader io.Reader) ([]string, error) {
+	var envs []string
+	scanner := bufio.NewScanner(reader)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		kv := strings.SplitN(line, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if len(key) == 0 || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("Invalid variable name %s in line %d", key, lineNum)
+		}
+		if len(kv) == 1 {
+			envs = append(envs, key)
+			continue
+		}
+
+		val := strings.TrimSpace(kv[1])
+		if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') {
+			if val[len(val)-1] != val[0] {
+				return nil, fmt.Errorf("Unterminated quote in line %d", lineNum)
+			}
+			// Escapes are only interpreted in double quotes.
+			if val[0] == '"' {
+				val = strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(val[1 : len(val)-1])
+			} else {
+				val = val[1 : len(val)-1]
 			}
+		} else if idx := strings.Index(val, " #"); idx >= 0 {
+			// An unquoted value ends before an inline comment.
+			val = strings.TrimSpace(val[:idx])
 		}
+		envs = append(envs, key+"="+val)
 	}
 
 	if err := scanner.Err(); err != nil {
-		log.Error("Parse /proc/self/mountinfo error %v", err)
+		return nil, fmt.Errorf("Scan() error %v", err)
 	}
 
-	return ""
+	return envs, nil
 }
 
-func GetCgroupPath(subsystem, cgroupPath string, autoCreate bool) (string, error) {
-	cgroupRoot := FindCgroupMountPoint(subsystem)
-	cgroupDirPath := filepath.Join(cgroupRoot, cgroupPath)
-	if _, err := os.Stat(cgroupDirPath); err != nil {
-		if os.IsNotExist(err) && autoCreate {
-			if err := os.Mkdir(cgroupDirPath, 0755); err != nil {
-				return "", fmt.Errorf("Mkdir() %s error %v", cgroupDirPath, err)
-			}
-		} else {
-			return "", fmt.Errorf("Stat() %s error %v", cgroupDirPath, err)
-		}
+// A decimal number with an optional unit like 512m, 1.5gb or 1024b.
+// Exponents, signs, inf and nan are not sizes.
+var byteSizeRegexp = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)(?:([kmgt])b?|b)?$`)
+
+// Parse a human-readable size like 512m, 1.5g or 1024 into bytes.
+// The units b, k, m, g and t are powers of 1024 and case insensitive.
+// A fraction of a byte is truncated.
+func ParseByteSize(size string) (int64, error) {
+	size = strings.ToLower(strings.TrimSpace(size))
+	matches := byteSizeRegexp.FindStringSubmatch(size)
+	if matches == nil {
+		return 0, fmt.Errorf("Invalid size %s", size)
 	}
 
-	return cgroupDirPath, nil
+	units := map[string]int64{
+		"":  1,
+		"k": 1 << 10,
+		"m": 1 << 20,
+		"g": 1 << 30,
+		"t": 1 << 40,
+	}
+	// Compute exactly, so that a large size is neither rounded nor overflowed.
+	num, ok := new(big.Rat).SetString(matches[1])
+	if !ok {
+		return 0, fmt.Errorf("Invalid size %s", size)
+	}
+	num.Mul(num, new(big.Rat).SetInt64(units[matches[2]]))
+	bytes := new(big.Int).Quo(num.Num(), num.Denom())
+	if !bytes.IsInt64() {
+		return 0, fmt.Errorf("Size %s exceeds %d bytes", size, int64(math.MaxInt64))
+	}
+
+	return bytes.Int64(), nil
+}
+
+// Return the major and minor numbers of the block device at path.
+func GetBlockDeviceNumber(path string) (int64, int64, error) {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(path, &stat); err != nil {
+		return 0, 0, fmt.Errorf("Stat() %s error %v", path, err)
+	}
+	if stat.Mode&syscall.S_IFMT != syscall.S_IFBLK {
+		return 0, 0, fmt.Errorf("%s is not a block device", path)
+	}
+
+	// The same encoding as major() and minor() of glibc.
+	rdev := uint64(stat.Rdev)
+	major := int64((rdev>>8)&0xfff | (rdev>>32)&^0xfff)
+	minor := int64(rdev&0xff | (rdev>>12)&^0xff)
+
+	return major, minor, nil
 }
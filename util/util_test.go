@@ -0,0 +1,79 @@
+package util
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		size    string
+		want    int64
+		wantErr bool
+	}{
+		{size: "1024", want: 1024},
+		{size: "1b", want: 1},
+		{size: "4k", want: 4096},
+		{size: "512m", want: 512 << 20},
+		{size: "512MB", want: 512 << 20},
+		{size: "1.5g", want: 3 << 29},
+		{size: "2T", want: 2 << 40},
+		{size: "", wantErr: true},
+		{size: "m", wantErr: true},
+		{size: "-1m", wantErr: true},
+		{size: "12x", wantErr: true},
+		{size: "0.5k", want: 512},
+		{size: "1.5", want: 1},
+		{size: "9223372036854775807", want: 1<<63 - 1},
+		{size: "8388607t", want: 8388607 << 40},
+		{size: "9223372036854775808", wantErr: true},
+		{size: "8388608t", wantErr: true},
+		{size: "inf", wantErr: true},
+		{size: "nan", wantErr: true},
+		{size: "1e400", wantErr: true},
+		{size: "1e3", wantErr: true},
+		{size: "0x10", wantErr: true},
+		{size: "+1m", wantErr: true},
+		{size: ".5m", wantErr: true},
+		{size: "1.m", wantErr: true},
+		{size: "1bb", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.size, func(t *testing.T) {
+			got, err := ParseByteSize(tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseByteSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseByteSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEnvFile(t *testing.T) {
+	content := `# comment
+A=1
+export B="x y\n#z"
+C='$HOME # not comment'
+D=http://host:80 # comment
+
+E=
+F
+`
+	want := []string{"A=1", "B=x y\n#z", "C=$HOME # not comment", "D=http://host:80", "E=", "F"}
+	got, err := ParseEnvFile(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("ParseEnvFile() error %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseEnvFile() = %q, want %q", got, want)
+	}
+
+	for _, content := range []string{"=1", "A B=1", `A="1`} {
+		if _, err := ParseEnvFile(strings.NewReader(content)); err == nil {
+			t.Errorf("ParseEnvFile() %s succeeds", content)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package volume
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/chengzeyi/dicker/container"
+)
+
+const (
+	DEFAULT_VOLUME_DIR_PATH = "/root/.dicker/volumes"
+	VOLUME_DATA_DIR_NAME    = "_data"
+	VOLUME_CONFIG_FILE_NAME = "volume.json"
+	// Taken while the volumes are changed, so that concurrent dicker
+	// processes do not lose references.
+	VOLUME_LOCK_FILE_NAME = ".lock"
+)
+
+// Names of volumes are valid directory names, and never absolute paths so
+// that they are told apart from host paths.
+var volumeNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+type Volume struct {
+	Name       string                  `json:"name"`
+	Driver     string                  `json:"driver"`
+	Options    container.VolumeOptions `json:"options"`     // Options of the driver.
+	Mountpoint string                  `json:"mountpoint"`  // Host path bound into containers.
+	CreateTime string                  `json:"create_time"` // Volume created time.
+	Labels     map[string]string       `json:"labels"`
+	Containers []string                `json:"containers"` // Ids of the containers using the volume.
+}
+
+// Volumes are stored under this directory, like
+// volumeDirPath/<name>/volume.json and volumeDirPath/<name>/_data.
+// It is a variable for tests.
+var volumeDirPath = DEFAULT_VOLUME_DIR_PATH
+
+func ValidateVolumeName(name string) error {
+	if !volumeNameRegexp.MatchString(name) {
+		return fmt.Errorf("Invalid volume name %s, only [a-zA-Z0-9][a-zA-Z0-9_.-]* are allowed", name)
+	}
+
+	return nil
+}
+
+// Create an empty volume provided by the driver called driverName.
+func CreateVolume(name, driverName string, options container.VolumeOptions, labels map[string]string) (*Volume, error) {
+	unlock, err := lock()
+	if err != nil {
+		return nil, fmt.Errorf("lock() error %v", err)
+	}
+	defer unlock()
+
+	return createVolume(name, driverName, options, labels)
+}
+
+func createVolume(name, driverName string, options container.VolumeOptions, labels map[string]string) (*Volume, error) {
+	if err := ValidateVolumeName(name); err != nil {
+		return nil, err
+	}
+	driver, err := container.GetVolumeDriver(driverName)
+	if err != nil {
+		return nil, fmt.Errorf("GetVolumeDriver() %s error %v", driverName, err)
+	}
+	if err := driver.Validate(options); err != nil {
+		return nil, fmt.Errorf("Validate() options %v error %v", options, err)
+	}
+	if _, err := os.Stat(filepath.Join(volumeDirPath, name)); err == nil {
+		return nil, fmt.Errorf("Volume %s already exists", name)
+	}
+
+	v := &Volume{
+		Name:       name,
+		Driver:     driverName,
+		Options:    options,
+		Mountpoint: filepath.Join(volumeDirPath, name, VOLUME_DATA_DIR_NAME),
+		CreateTime: time.Now().Format("2006-01-02 15:04:05"),
+		Labels:     labels,
+	}
+	if len(v.Driver) == 0 {
+		v.Driver = container.VOLUME_DRIVER_LOCAL
+	}
+	if err := os.MkdirAll(v.Mountpoint, 0755); err != nil {
+		return nil, fmt.Errorf("MkdirAll() %s error %v", v.Mountpoint, err)
+	}
+	if err := driver.Create(v.Mountpoint, options); err != nil {
+		os.RemoveAll(filepath.Join(volumeDirPath, name))
+		return nil, fmt.Errorf("Create() %s with driver %s error %v", name, v.Driver, err)
+	}
+	if err := v.dump(); err != nil {
+		driver.Remove(v.Mountpoint)
+		os.RemoveAll(filepath.Join(volumeDirPath, name))
+		return nil, fmt.Errorf("dump() %s error %v", name, err)
+	}
+
+	return v, nil
+}
+
+func LoadVolume(name string) (*Volume, error) {
+	if err := ValidateVolumeName(name); err != nil {
+		return nil, err
+	}
+	configPath := filepath.Join(volumeDirPath, name, VOLUME_CONFIG_FILE_NAME)
+	contentBytes, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("Volume %s not exists", name)
+		}
+		return nil, fmt.Errorf("ReadFile() %s error %v", configPath, err)
+	}
+
+	v := &Volume{}
+	if err := json.Unmarshal(contentBytes, v); err != nil {
+		return nil, fmt.Errorf("Unmarshal() %s error %v", configPath, err)
+	}
+
+	return v, nil
+}
+
+// Load all the volumes sorted by name.
+// Directories without a valid config file are skipped.
+func ListVolumes() ([]*Volume, error) {
+	dirInfos, err := ioutil.ReadDir(volumeDirPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ReadDir() %s error %v", volumeDirPath, err)
+	}
+
+	var volumes []*Volume
+	for _, dirInfo := range dirInfos {
+		if !dirInfo.IsDir() {
+			continue
+		}
+		v, err := LoadVolume(dirInfo.Name())
+		if err != nil {
+			continue
+		}
+		volumes = append(volumes, v)
+	}
+	sort.Slice(volumes, func(i, j int) bool {
+		return volumes[i].Name < volumes[j].Name
+	})
+
+	return volumes, nil
+}
+
+// Record that container containerId uses the volume, and create a local volume if it
+// does not exist. Return whether the volume is created.
+func AcquireVolume(name, containerId string) (*Volume, bool, error) {
+	unlock, err := lock()
+	if err != nil {
+		return nil, false, fmt.Errorf("lock() error %v", err)
+	}
+	defer unlock()
+
+	created := false
+	v, err := LoadVolume(name)
+	if err != nil {
+		if _, statErr := os.Stat(filepath.Join(volumeDirPath, name)); !os.IsNotExist(statErr) {
+			return nil, false, fmt.Errorf("LoadVolume() %s error %v", name, err)
+		}
+		if v, err = createVolume(name, container.VOLUME_DRIVER_LOCAL, container.VolumeOptions{}, nil); err != nil {
+			return nil, false, fmt.Errorf("createVolume() %s error %v", name, err)
+		}
+		created = true
+	}
+
+	for _, c := range v.Containers {
+		if c == containerId {
+			return v, created, nil
+		}
+	}
+	v.Containers = append(v.Containers, containerId)
+	if err := v.dump(); err != nil {
+		return nil, false, fmt.Errorf("dump() %s error %v", name, err)
+	}
+
+	return v, created, nil
+}
+
+// Remove container containerId from the users of the volume.
+// The volume is kept even if nobody uses it.
+func ReleaseVolume(name, containerId string) error {
+	unlock, err := lock()
+	if err != nil {
+		return fmt.Errorf("lock() error %v", err)
+	}
+	defer unlock()
+
+	if _, err := os.Stat(filepath.Join(volumeDirPath, name)); os.IsNotExist(err) {
+		return nil
+	}
+	v, err := LoadVolume(name)
+	if err != nil {
+		return fmt.Errorf("LoadVolume() %s error %v", name, err)
+	}
+	var containers []string
+	for _, c := range v.Containers {
+		if c != containerId {
+			containers = append(containers, c)
+		}
+	}
+	if len(containers) == len(v.Containers) {
+		return nil
+	}
+	v.Containers = containers
+	if err := v.dump(); err != nil {
+		return fmt.Errorf("dump() %s error %v", name, err)
+	}
+
+	return nil
+}
+
+// Remove the volume and its data. A volume in use cannot be removed.
+// exists reports whether a container still exists, so that references of
+// containers removed without releasing their volumes are ignored.
+func RemoveVolume(name string, exists func(containerId string) bool) error {
+	unlock, err := lock()
+	if err != nil {
+		return fmt.Errorf("lock() error %v", err)
+	}
+	defer unlock()
+
+	v, err := LoadVolume(name)
+	if err != nil {
+		return fmt.Errorf("LoadVolume() %s error %v", name, err)
+	}
+
+	return v.remove(exists)
+}
+
+// Remove all the volumes not used by any container and return their names.
+func PruneVolumes(exists func(containerId string) bool) ([]string, error) {
+	unlock, err := lock()
+	if err != nil {
+		return nil, fmt.Errorf("lock() error %v", err)
+	}
+	defer unlock()
+
+	volumes, err := ListVolumes()
+	if err != nil {
+		return nil, fmt.Errorf("ListVolumes() error %v", err)
+	}
+	var pruned []string
+	for _, v := range volumes {
+		if len(v.InUseBy(exists)) != 0 {
+			continue
+		}
+		if err := v.remove(exists); err != nil {
+			return pruned, fmt.Errorf("remove() %s error %v", v.Name, err)
+		}
+		pruned = append(pruned, v.Name)
+	}
+
+	return pruned, nil
+}
+
+// Return the existing containers using the volume.
+func (v *Volume) InUseBy(exists func(containerId string) bool) []string {
+	var containers []string
+	for _, c := range v.Containers {
+		if exists(c) {
+			containers = append(containers, c)
+		}
+	}
+
+	return containers
+}
+
+func (v *Volume) remove(exists func(containerId string) bool) error {
+	if containers := v.InUseBy(exists); len(containers) != 0 {
+		return fmt.Errorf("Volume %s is in use by %v", v.Name, containers)
+	}
+
+	driver, err := container.GetVolumeDriver(v.Driver)
+	if err != nil {
+		return fmt.Errorf("GetVolumeDriver() %s error %v", v.Driver, err)
+	}
+	if err := driver.Remove(v.Mountpoint); err != nil {
+		return fmt.Errorf("Remove() %s with driver %s error %v", v.Name, v.Driver, err)
+	}
+
+	dirPath := filepath.Join(volumeDirPath, v.Name)
+	if err := os.RemoveAll(dirPath); err != nil {
+		return fmt.Errorf("RemoveAll() %s error %v", dirPath, err)
+	}
+
+	return nil
+}
+
+// Write to a temporary file and rename it, so that readers never see a
+// partial config.
+func (v *Volume) dump() error {
+	jsonBytes, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("Marshal() %v error %v", v, err)
+	}
+
+	filePath := filepath.Join(volumeDirPath, v.Name, VOLUME_CONFIG_FILE_NAME)
+	tmpFilePath := fmt.Sprintf("%s.%d.tmp", filePath, os.Getpid())
+	if err := ioutil.WriteFile(tmpFilePath, jsonBytes, 0644); err != nil {
+		return fmt.Errorf("WriteFile() %s error %v", tmpFilePath, err)
+	}
+	if err := os.Rename(tmpFilePath, filePath); err != nil {
+		return fmt.Errorf("Rename() %s to %s error %v", tmpFilePath, filePath, err)
+	}
+
+	return nil
+}
+
+func lock() (func(), error) {
+	if err := os.MkdirAll(volumeDirPath, 0755); err != nil {
+		return nil, fmt.Errorf("MkdirAll() %s error %v", volumeDirPath, err)
+	}
+	lockFilePath := filepath.Join(volumeDirPath, VOLUME_LOCK_FILE_NAME)
+	lockFile, err := os.OpenFile(lockFilePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("OpenFile() %s error %v", lockFilePath, err)
+	}
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		lockFile.Close()
+		return nil, fmt.Errorf("Flock() %s error %v", lockFilePath, err)
+	}
+
+	return func() {
+		syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+		lockFile.Close()
+	}, nil
+}
@@ -0,0 +1,79 @@
+package volume
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/chengzeyi/dicker/container"
+)
+
+func TestVolumeReferences(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "volumes")
+	if err != nil {
+		t.Fatalf("TempDir() error %v", err)
+	}
+	defer os.RemoveAll(dirPath)
+	volumeDirPath = dirPath
+	defer func() { volumeDirPath = DEFAULT_VOLUME_DIR_PATH }()
+
+	existing := map[string]bool{"c1": true, "c2": true}
+	exists := func(containerName string) bool { return existing[containerName] }
+
+	if _, err := CreateVolume("/abs", "", container.VolumeOptions{}, nil); err == nil {
+		t.Errorf("CreateVolume() of an absolute path succeeds")
+	}
+	if _, err := CreateVolume("sized", container.VOLUME_DRIVER_LOCAL, container.VolumeOptions{Size: 1 << 20}, nil); err == nil {
+		t.Errorf("CreateVolume() of a local volume with a size succeeds")
+	}
+	if _, err := CreateVolume("unsized", container.VOLUME_DRIVER_LOOP, container.VolumeOptions{}, nil); err == nil {
+		t.Errorf("CreateVolume() of a loop volume without a size succeeds")
+	}
+	if _, err := CreateVolume("idle", container.VOLUME_DRIVER_LOCAL, container.VolumeOptions{}, map[string]string{"k": "v"}); err != nil {
+		t.Fatalf("CreateVolume() error %v", err)
+	}
+	if _, err := CreateVolume("idle", "", container.VolumeOptions{}, nil); err == nil {
+		t.Errorf("CreateVolume() of an existing volume succeeds")
+	}
+
+	if _, created, err := AcquireVolume("data", "c1"); err != nil || !created {
+		t.Fatalf("AcquireVolume() = %v, %v, want created", created, err)
+	}
+	v, created, err := AcquireVolume("data", "c2")
+	if err != nil || created {
+		t.Fatalf("AcquireVolume() = %v, %v, want not created", created, err)
+	}
+	if _, err := os.Stat(v.Mountpoint); err != nil {
+		t.Errorf("Stat() mountpoint error %v", err)
+	}
+	if err := RemoveVolume("data", exists); err == nil {
+		t.Errorf("RemoveVolume() of a volume in use succeeds")
+	}
+
+	if err := ReleaseVolume("data", "c1"); err != nil {
+		t.Fatalf("ReleaseVolume() error %v", err)
+	}
+	if v, err = LoadVolume("data"); err != nil {
+		t.Fatalf("LoadVolume() error %v", err)
+	}
+	if !reflect.DeepEqual(v.Containers, []string{"c2"}) {
+		t.Errorf("Containers = %v, want [c2]", v.Containers)
+	}
+
+	// c2 is gone without releasing the volume.
+	delete(existing, "c2")
+	pruned, err := PruneVolumes(exists)
+	if err != nil {
+		t.Fatalf("PruneVolumes() error %v", err)
+	}
+	if !reflect.DeepEqual(pruned, []string{"data", "idle"}) {
+		t.Errorf("PruneVolumes() = %v, want [data idle]", pruned)
+	}
+	if volumes, _ := ListVolumes(); len(volumes) != 0 {
+		t.Errorf("ListVolumes() = %v after prune", volumes)
+	}
+	if err := ReleaseVolume("data", "c2"); err != nil {
+		t.Errorf("ReleaseVolume() of a removed volume error %v", err)
+	}
+}